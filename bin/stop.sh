@@ -9,7 +9,7 @@ function stop()
         return 0
     fi
     srv="$PWD/$server"
-    ps gaux | grep $srv | grep -v grep | awk '{print $2}' | xargs kill -9
+    ps gaux | grep $srv | grep -v grep | awk '{print $2}' | xargs kill -TERM
 }
 
 stop $*
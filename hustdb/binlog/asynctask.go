@@ -1,6 +1,9 @@
 package binlog
 
 import (
+	"sync"
+	"time"
+
 	def "../../internal/defines"
 )
 
@@ -28,6 +31,32 @@ func Init(conf def.BinlogConf) {
 
 var globalBinlogTaskChan map[int]chan *BinlogTask
 
+// pendingTasks counts the tasks delivered but not yet executed. Unlike a
+// WaitGroup it may grow while Drain waits, which happens when writes still
+// in flight deliver their tasks during shutdown.
+var pendingTasks struct {
+	lock  sync.Mutex
+	count int
+	// closed when count drops to zero, made by the first Drain waiting
+	idle chan struct{}
+}
+
+func taskDelivered() {
+	pendingTasks.lock.Lock()
+	pendingTasks.count++
+	pendingTasks.lock.Unlock()
+}
+
+func taskDone() {
+	pendingTasks.lock.Lock()
+	pendingTasks.count--
+	if pendingTasks.count == 0 && pendingTasks.idle != nil {
+		close(pendingTasks.idle)
+		pendingTasks.idle = nil
+	}
+	pendingTasks.lock.Unlock()
+}
+
 func RunBinlog() {
 	for idx, _ := range globalBinlogTaskChan {
 		go func(idx int) {
@@ -39,6 +68,7 @@ func RunBinlog() {
 					} else {
 						task.Req()
 					}
+					taskDone()
 				}
 			}
 		}(idx)
@@ -49,6 +79,37 @@ func DeliverBinlogTask(idx int, taskFunc TaskFunc, ch chan interface{}) {
 	taskCh, exists := globalBinlogTaskChan[idx]
 	if exists {
 		task := &BinlogTask{Req: taskFunc, Ack: ch}
+		taskDelivered()
 		taskCh <- task
 	}
 }
+
+// QueueDepth returns the number of pending tasks of each binlog routine.
+func QueueDepth() []int {
+	depth := make([]int, len(globalBinlogTaskChan))
+	for idx, ch := range globalBinlogTaskChan {
+		depth[idx] = len(ch)
+	}
+	return depth
+}
+
+// Drain waits until every delivered task has run, or the timeout expires.
+// It returns false on timeout.
+func Drain(timeout time.Duration) bool {
+	pendingTasks.lock.Lock()
+	if pendingTasks.count == 0 {
+		pendingTasks.lock.Unlock()
+		return true
+	}
+	if pendingTasks.idle == nil {
+		pendingTasks.idle = make(chan struct{})
+	}
+	done := pendingTasks.idle
+	pendingTasks.lock.Unlock()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
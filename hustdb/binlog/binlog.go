@@ -1,6 +1,8 @@
 package binlog
 
 import (
+	"sync/atomic"
+
 	"../../internal/utils"
 	"../comm"
 
@@ -20,6 +22,14 @@ var (
 	}
 )
 
+// failures counts the binlog writes the backends refused
+var failures uint64
+
+// Failures returns the number of binlog tasks that failed.
+func Failures() uint64 {
+	return atomic.LoadUint64(&failures)
+}
+
 func Do(succBackend, failBackend, cmd string, args map[string][]byte, val []byte) {
 	switch cmd {
 	case "put":
@@ -60,12 +70,12 @@ func Do(succBackend, failBackend, cmd string, args map[string][]byte, val []byte
 }
 
 func HandleHustdbWriteFailedTask(succBackend string, args map[string][]byte, val []byte) {
-	var code int
 	retCh := make(chan interface{}, 1)
 
 	DeliverBinlogTask(utils.NgxHashKey(succBackend)%BinlogRoutineCnt, func() interface{} {
-		code = comm.HustdbBinlog(succBackend, args, val)
-		return true
+		return comm.HustdbBinlog(succBackend, args, val) == comm.HttpOk
 	}, retCh)
-	<-retCh
+	if ok, _ := (<-retCh).(bool); !ok {
+		atomic.AddUint64(&failures, 1)
+	}
 }
@@ -0,0 +1,107 @@
+package comm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	def "../../internal/defines"
+	"../../internal/httpman"
+)
+
+var (
+	// backendLock guards backendConfs, which a reload of backends.json
+	// replaces
+	backendLock  sync.RWMutex
+	backendConfs map[string]*def.BackendConf
+)
+
+// SetBackendConfs validates the per backend settings and switches to them.
+// Relative file names are taken from dir. Nothing changes on error.
+func SetBackendConfs(confs map[string]*def.BackendConf, dir string) error {
+	tlsConfigs := make(map[string]*tls.Config)
+	for backend, conf := range confs {
+		switch conf.Scheme {
+		case "", "http":
+		case "https":
+			config, err := backendTLSConfig(conf, dir)
+			if err != nil {
+				return fmt.Errorf("backend %s: %v", backend, err)
+			}
+			tlsConfigs[backend] = config
+		default:
+			return fmt.Errorf("backend %s: unknown scheme %q", backend, conf.Scheme)
+		}
+	}
+
+	httpman.SetTLSConfigs(tlsConfigs)
+	backendLock.Lock()
+	backendConfs = confs
+	backendLock.Unlock()
+	return nil
+}
+
+func backendTLSConfig(conf *def.BackendConf, dir string) (*tls.Config, error) {
+	path := func(file string) string {
+		if filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+	config := &tls.Config{ServerName: conf.ServerName}
+	if conf.CaFile != "" {
+		pem, err := ioutil.ReadFile(path(conf.CaFile))
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", conf.CaFile)
+		}
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(path(conf.CertFile), path(conf.KeyFile))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func backendConf(backend string) *def.BackendConf {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+	return backendConfs[backend]
+}
+
+func schemeOf(backend string) string {
+	if conf := backendConf(backend); conf != nil && conf.Scheme != "" {
+		return conf.Scheme
+	}
+	return "http"
+}
+
+// backendOf returns the host:port a url points at.
+func backendOf(url string) string {
+	backend := url
+	if idx := strings.Index(backend, "://"); idx >= 0 {
+		backend = backend[idx+3:]
+	}
+	if idx := strings.IndexByte(backend, '/'); idx >= 0 {
+		backend = backend[:idx]
+	}
+	return backend
+}
+
+// credentialsFor picks the account of the backend the url points at.
+func credentialsFor(url string) (string, string) {
+	if conf := backendConf(backendOf(url)); conf != nil && conf.User != "" {
+		return conf.User, conf.Passwd
+	}
+	return credentials()
+}
@@ -3,8 +3,10 @@ package comm
 import (
 	"bytes"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	def "../../internal/defines"
 	"../../internal/httpman"
@@ -24,168 +26,188 @@ func init() {
 	hustdbReqHeader["Content-Type"] = "text/plain"
 }
 
+// credLock guards hustdbUser and hustdbPwd, a reload may change them
+var credLock sync.RWMutex
+
 func HustdbInit(conf *def.HustdbConf) {
+	credLock.Lock()
 	hustdbUser = conf.User
 	hustdbPwd = conf.Passwd
+	credLock.Unlock()
+}
+
+func credentials() (string, string) {
+	credLock.RLock()
+	defer credLock.RUnlock()
+	return hustdbUser, hustdbPwd
 }
 
 func ComposeUrl(backend string, op string, fieldmap map[string][]byte) string {
 	var buffer bytes.Buffer
-	buffer.WriteString("http://")
+	buffer.WriteString(schemeOf(backend))
+	buffer.WriteString("://")
 	buffer.WriteString(backend)
 	buffer.WriteString("/hustdb/")
 	buffer.WriteString(op)
 	buffer.WriteString("?")
 	for k, v := range fieldmap {
-		buffer.WriteString(k)
+		buffer.WriteString(escapeField(k))
 		buffer.WriteString("=")
-		buffer.Write(v)
+		buffer.WriteString(escapeField(utils.BytesToString(v)))
 		buffer.WriteString("&")
 	}
 
 	return strings.TrimSuffix(buffer.String(), "&")
 }
 
+// escapeField percent-encodes every byte outside the unreserved set. Spaces
+// are sent as %20 rather than '+', since hustdb unescapes the query string
+// the way nginx does and does not treat '+' as a space.
+func escapeField(field string) string {
+	return strings.Replace(url.QueryEscape(field), "+", "%20", -1)
+}
+
 /* Hustdb kv API */
-func HustdbPut(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbPut(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "put", args)
-	httpCode, _, _ := HttpPost(url, val)
-	retChan <- &HustdbResponse{Code: httpCode, Backend: backend}
+	httpCode, _, respHeader := c.httpPost(url, val)
+	ver, _ := strconv.Atoi(respHeader.Get("Version"))
+	retChan <- &HustdbResponse{Code: httpCode, Backend: backend, Version: ver}
 }
 
-func HustdbGet(backend string, args map[string][]byte) *HustdbResponse {
+func (c *Client) HustdbGet(backend string, args map[string][]byte) *HustdbResponse {
 	url := ComposeUrl(backend, "get", args)
-	httpCode, body, _ := HttpGet(url)
+	httpCode, body, _ := c.httpGet(url)
 
 	return &HustdbResponse{Code: httpCode, Data: body}
 }
 
-func HustdbGet2(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbGet2(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "get", args)
-	httpCode, body, header := HttpGet(url)
+	httpCode, body, header := c.httpGet(url)
 	ver, _ := strconv.Atoi(header.Get("Version"))
 
 	retChan <- &HustdbResponse{Code: httpCode, Data: body, Version: ver}
 }
 
-func HustdbDel(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbDel(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "del", args)
-	httpCode, _, _ := HttpGet(url)
+	httpCode, _, _ := c.httpGet(url)
 	retChan <- &HustdbResponse{Code: httpCode, Backend: backend}
 }
 
-func HustdbExist(backend string, args map[string][]byte) *HustdbResponse {
+func (c *Client) HustdbExist(backend string, args map[string][]byte) *HustdbResponse {
 	url := ComposeUrl(backend, "exist", args)
-	httpCode, _, _ := HttpGet(url)
+	httpCode, _, _ := c.httpGet(url)
 	return &HustdbResponse{Code: httpCode}
 }
 
 /* Hustdb hash API */
-func HustdbHset(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbHset(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "hset", args)
-	httpCode, _, respHeader := HttpPost(url, val)
+	httpCode, _, respHeader := c.httpPost(url, val)
 	ver, _ := strconv.Atoi(respHeader.Get("Version"))
 	retChan <- &HustdbResponse{Code: httpCode, Version: ver, Backend: backend}
 }
 
-func HustdbHget(backend string, args map[string][]byte) *HustdbResponse {
+func (c *Client) HustdbHget(backend string, args map[string][]byte) *HustdbResponse {
 	url := ComposeUrl(backend, "hget", args)
-	httpCode, body, respHeader := HttpGet(url)
+	httpCode, body, respHeader := c.httpGet(url)
 	ver, _ := strconv.Atoi(respHeader.Get("Version"))
 
 	return &HustdbResponse{Code: httpCode, Data: body, Version: ver}
 }
 
-func HustdbHget2(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbHget2(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "hget", args)
-	httpCode, body, respHeader := HttpGet(url)
+	httpCode, body, respHeader := c.httpGet(url)
 	ver, _ := strconv.Atoi(respHeader.Get("Version"))
 
 	retChan <- &HustdbResponse{Code: httpCode, Data: body, Version: ver}
 }
 
-func HustdbHdel(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbHdel(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "hdel", args)
-	httpCode, _, _ := HttpGet(url)
+	httpCode, _, _ := c.httpGet(url)
 	retChan <- &HustdbResponse{Code: httpCode, Backend: backend}
 }
 
-func HustdbHexist(backend string, args map[string][]byte) *HustdbResponse {
+func (c *Client) HustdbHexist(backend string, args map[string][]byte) *HustdbResponse {
 	url := ComposeUrl(backend, "hexist", args)
-	httpCode, _, _ := HttpGet(url)
+	httpCode, _, _ := c.httpGet(url)
 	return &HustdbResponse{Code: httpCode}
 }
 
 /* Hustdb set API */
-func HustdbSadd(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbSadd(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "sadd", args)
-	httpCode, _, respHeader := HttpPost(url, val)
+	httpCode, _, respHeader := c.httpPost(url, val)
 	ver, _ := strconv.Atoi(respHeader.Get("Version"))
 	retChan <- &HustdbResponse{Code: httpCode, Backend: backend, Version: ver}
 }
 
-func HustdbSrem(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbSrem(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "srem", args)
-	httpCode, _, _ := HttpPost(url, val)
+	httpCode, _, _ := c.httpPost(url, val)
 	retChan <- &HustdbResponse{Code: httpCode, Backend: backend}
 }
 
-func HustdbSismember(backend string, args map[string][]byte, val []byte) *HustdbResponse {
+func (c *Client) HustdbSismember(backend string, args map[string][]byte, val []byte) *HustdbResponse {
 	url := ComposeUrl(backend, "sismember", args)
-	httpCode, _, _ := HttpPost(url, val)
+	httpCode, _, _ := c.httpPost(url, val)
 	return &HustdbResponse{Code: httpCode}
 }
 
-func HustdbZadd(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbZadd(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "zadd", args)
-	httpCode, body, respHeader := HttpPost(url, val)
+	httpCode, body, respHeader := c.httpPost(url, val)
 	ver, _ := strconv.Atoi(respHeader.Get("Version"))
 	retChan <- &HustdbResponse{Code: httpCode, Data: body, Backend: backend, Version: ver}
 }
 
-func HustdbZscore(backend string, args map[string][]byte, val []byte) *HustdbResponse {
+func (c *Client) HustdbZscore(backend string, args map[string][]byte, val []byte) *HustdbResponse {
 	url := ComposeUrl(backend, "zscore", args)
-	httpCode, body, _ := HttpPost(url, val)
+	httpCode, body, _ := c.httpPost(url, val)
 
 	return &HustdbResponse{Code: httpCode, Data: body}
 }
 
-func HustdbZscore2(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbZscore2(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "zscore", args)
-	httpCode, body, respHeader := HttpPost(url, val)
+	httpCode, body, respHeader := c.httpPost(url, val)
 	ver, _ := strconv.Atoi(respHeader.Get("Version"))
 
 	retChan <- &HustdbResponse{Code: httpCode, Data: body, Version: ver}
 }
 
-func HustdbZrem(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbZrem(backend string, args map[string][]byte, val []byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "zrem", args)
-	httpCode, _, _ := HttpPost(url, val)
+	httpCode, _, _ := c.httpPost(url, val)
 	retChan <- &HustdbResponse{Code: httpCode, Backend: backend}
 }
 
-func HustdbZismember(backend string, args map[string][]byte, val []byte) *HustdbResponse {
+func (c *Client) HustdbZismember(backend string, args map[string][]byte, val []byte) *HustdbResponse {
 	url := ComposeUrl(backend, "zismember", args)
-	httpCode, _, _ := HttpPost(url, val)
+	httpCode, _, _ := c.httpPost(url, val)
 	return &HustdbResponse{Code: httpCode}
 }
 
-func HustdbZrangebyrank(backend string, args map[string][]byte) (int, []byte) {
+func (c *Client) HustdbZrangebyrank(backend string, args map[string][]byte) (int, []byte) {
 	url := ComposeUrl(backend, "zrangebyrank", args)
-	httpCode, body, _ := HttpGet(url)
+	httpCode, body, _ := c.httpGet(url)
 
 	return httpCode, body
 }
 
-func HustdbZrangebyscore(backend string, args map[string][]byte) (int, []byte) {
+func (c *Client) HustdbZrangebyscore(backend string, args map[string][]byte) (int, []byte) {
 	url := ComposeUrl(backend, "zrangebyscore", args)
-	httpCode, body, _ := HttpGet(url)
+	httpCode, body, _ := c.httpGet(url)
 
 	return httpCode, body
 }
 
 func HustdbAlive(backend string) int {
-	url := utils.ConcatString("http://", backend, "/status.html")
+	url := utils.ConcatString(schemeOf(backend), "://", backend, "/status.html")
 	httpCode, _, _ := HttpGetWithTimeout(url)
 	return httpCode
 }
@@ -201,9 +223,9 @@ func HustdbBinlog(backend string, args map[string][]byte, val []byte) int {
 	return httpCode
 }
 
-func HustdbSismembers(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbSismembers(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "sismembers", args)
-	httpCode, body, _ := HttpGet(url)
+	httpCode, body, _ := c.httpGet(url)
 	if httpCode == HttpOk {
 		retChan <- &HustdbResponse{Code: httpCode, Data: body}
 	} else {
@@ -211,9 +233,9 @@ func HustdbSismembers(backend string, args map[string][]byte, retChan chan *Hust
 	}
 }
 
-func HustdbHkeys(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbHkeys(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "hkeys", args)
-	httpCode, body, _ := HttpGet(url)
+	httpCode, body, _ := c.httpGet(url)
 	if httpCode == HttpOk {
 		retChan <- &HustdbResponse{Code: httpCode, Data: body}
 	} else {
@@ -221,9 +243,9 @@ func HustdbHkeys(backend string, args map[string][]byte, retChan chan *HustdbRes
 	}
 }
 
-func HustdbKeys(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbKeys(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "keys", args)
-	httpCode, body, _ := HttpGet(url)
+	httpCode, body, _ := c.httpGet(url)
 	if httpCode == HttpOk {
 		retChan <- &HustdbResponse{Code: httpCode, Data: body}
 	} else {
@@ -231,9 +253,9 @@ func HustdbKeys(backend string, args map[string][]byte, retChan chan *HustdbResp
 	}
 }
 
-func HustdbStat(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
+func (c *Client) HustdbStat(backend string, args map[string][]byte, retChan chan *HustdbResponse) {
 	url := ComposeUrl(backend, "stat", args)
-	httpCode, body, _ := HttpGet(url)
+	httpCode, body, _ := c.httpGet(url)
 	if httpCode == HttpOk {
 		retChan <- &HustdbResponse{Code: httpCode, Data: body}
 	} else {
@@ -241,29 +263,33 @@ func HustdbStat(backend string, args map[string][]byte, retChan chan *HustdbResp
 	}
 }
 
-func HustdbHincrby(backend string, args map[string][]byte) *HustdbResponse {
+func (c *Client) HustdbHincrby(backend string, args map[string][]byte) *HustdbResponse {
 	url := ComposeUrl(backend, "hincrby", args)
-	httpCode, body, _ := HttpGet(url)
+	httpCode, body, _ := c.httpGet(url)
 
 	return &HustdbResponse{Code: httpCode, Data: body}
 }
 
 func HttpPostWithTimeout(url string, data []byte) (int, []byte, http.Header) {
 	defer Protect()
-	return httpman.HttpBasicWithTimeout(url, "POST", data, hustdbReqHeader, hustdbUser, hustdbPwd)
+	user, passwd := credentialsFor(url)
+	return httpman.HttpBasicWithTimeout(url, "POST", data, hustdbReqHeader, user, passwd)
 }
 
 func HttpPost(url string, data []byte) (int, []byte, http.Header) {
 	defer Protect()
-	return httpman.HttpBasic(url, "POST", data, hustdbReqHeader, hustdbUser, hustdbPwd)
+	user, passwd := credentialsFor(url)
+	return httpman.HttpBasic(url, "POST", data, hustdbReqHeader, user, passwd)
 }
 
 func HttpGetWithTimeout(url string) (int, []byte, http.Header) {
 	defer Protect()
-	return httpman.HttpBasicWithTimeout(url, "GET", nil, hustdbReqHeader, hustdbUser, hustdbPwd)
+	user, passwd := credentialsFor(url)
+	return httpman.HttpBasicWithTimeout(url, "GET", nil, hustdbReqHeader, user, passwd)
 }
 
 func HttpGet(url string) (int, []byte, http.Header) {
 	defer Protect()
-	return httpman.HttpBasic(url, "GET", nil, hustdbReqHeader, hustdbUser, hustdbPwd)
+	user, passwd := credentialsFor(url)
+	return httpman.HttpBasic(url, "GET", nil, hustdbReqHeader, user, passwd)
 }
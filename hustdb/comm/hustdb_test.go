@@ -0,0 +1,51 @@
+package comm
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestComposeUrlKeys(t *testing.T) {
+	keys := []string{
+		"plain",
+		"a&b=c",
+		"k=v",
+		"what?",
+		"#fragment",
+		"100%",
+		"%41",
+		"a+b",
+		"a b",
+		" lead and trail ",
+		"nul\x00inside",
+		"\xff\xfe not utf-8 \x80",
+		"中文",
+		"",
+	}
+	for _, key := range keys {
+		raw := ComposeUrl("127.0.0.1:8085", "get", map[string][]byte{"key": []byte(key), "tb": []byte(key)})
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Errorf("key %q: %s does not parse: %v", key, raw, err)
+			continue
+		}
+		if u.Path != "/hustdb/get" || u.Fragment != "" {
+			t.Errorf("key %q: %s has path %q, fragment %q", key, raw, u.Path, u.Fragment)
+		}
+		// hustdb does not read '+' as a space
+		if strings.ContainsAny(u.RawQuery, "+ ") {
+			t.Errorf("key %q: query %q holds '+' or a space", key, u.RawQuery)
+		}
+		query, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			t.Errorf("key %q: query %q: %v", key, u.RawQuery, err)
+			continue
+		}
+		for _, field := range []string{"key", "tb"} {
+			if got := query[field]; len(got) != 1 || got[0] != key {
+				t.Errorf("key %q: %s decodes to %s %q", key, raw, field, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package comm
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendCall is one request a command made to hustdb.
+type BackendCall struct {
+	Backend string
+	Op      string
+	Code    int
+	Elapsed time.Duration
+}
+
+// Trace collects the backend calls of one command, the requests of a
+// command may run in parallel.
+type Trace struct {
+	lock  sync.Mutex
+	calls []BackendCall
+}
+
+func NewTrace() *Trace {
+	return &Trace{}
+}
+
+func (t *Trace) add(call BackendCall) {
+	t.lock.Lock()
+	t.calls = append(t.calls, call)
+	t.lock.Unlock()
+}
+
+func (t *Trace) Calls() []BackendCall {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]BackendCall(nil), t.calls...)
+}
+
+// Client sends the hustdb requests of a command and records them in its
+// trace. A Client without a trace records nothing.
+type Client struct {
+	trace *Trace
+}
+
+func NewClient(trace *Trace) *Client {
+	return &Client{trace: trace}
+}
+
+func (c *Client) httpGet(url string) (int, []byte, http.Header) {
+	startTs := time.Now()
+	code, body, header := HttpGet(url)
+	c.record(url, code, startTs)
+	return code, body, header
+}
+
+func (c *Client) httpPost(url string, data []byte) (int, []byte, http.Header) {
+	startTs := time.Now()
+	code, body, header := HttpPost(url, data)
+	c.record(url, code, startTs)
+	return code, body, header
+}
+
+func (c *Client) record(url string, code int, startTs time.Time) {
+	if c.trace == nil {
+		return
+	}
+	op := url
+	if idx := strings.Index(op, "/hustdb/"); idx >= 0 {
+		op = op[idx+len("/hustdb/"):]
+	}
+	if idx := strings.IndexByte(op, '?'); idx >= 0 {
+		op = op[:idx]
+	}
+	c.trace.add(BackendCall{
+		Backend: backendOf(url),
+		Op:      op,
+		Code:    code,
+		Elapsed: time.Since(startTs),
+	})
+}
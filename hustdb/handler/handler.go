@@ -9,10 +9,19 @@ import (
 )
 
 type HustdbHandler struct {
+	client *comm.Client
 }
 
 func NewHustdbHandler() *HustdbHandler {
-	return &HustdbHandler{}
+	return &HustdbHandler{client: comm.NewClient(nil)}
+}
+
+// WithTrace returns a handler recording its backend requests in trace.
+func (p *HustdbHandler) WithTrace(trace *comm.Trace) *HustdbHandler {
+	if trace == nil {
+		return p
+	}
+	return &HustdbHandler{client: comm.NewClient(trace)}
 }
 
 var NilHustdbResponse = &comm.HustdbResponse{Code: 0}
@@ -25,7 +34,7 @@ func (p *HustdbHandler) HustdbStat(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbStat(backend, args, retChan)
+		go p.client.HustdbStat(backend, args, retChan)
 	}
 
 	hustdbResp := &comm.HustdbResponse{Code: 0}
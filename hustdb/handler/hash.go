@@ -15,7 +15,7 @@ func (p *HustdbHandler) HustdbHget(args map[string][]byte) *comm.HustdbResponse
 
 	backends := peers.FetchHustdbPeers(string(key))
 	for _, backend := range backends {
-		resp := comm.HustdbHget(backend, args)
+		resp := p.client.HustdbHget(backend, args)
 		if resp.Code == comm.HttpOk {
 			return resp
 		}
@@ -38,7 +38,7 @@ func (p *HustdbHandler) HustdbHget2(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbHget2(backend, args, retChan)
+		go p.client.HustdbHget2(backend, args, retChan)
 	}
 
 	maxVer := 0
@@ -73,7 +73,7 @@ func (p *HustdbHandler) HustdbHset(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbHset(backend, args, val, retChan)
+		go p.client.HustdbHset(backend, args, val, retChan)
 	}
 
 	putSucc := 0
@@ -116,7 +116,7 @@ func (p *HustdbHandler) HustdbHexist(args map[string][]byte) *comm.HustdbRespons
 	}
 
 	for _, backend := range backends {
-		resp := comm.HustdbHexist(backend, args)
+		resp := p.client.HustdbHexist(backend, args)
 		if resp.Code == comm.HttpOk {
 			return resp
 		}
@@ -138,7 +138,7 @@ func (p *HustdbHandler) HustdbHdel(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbHdel(backend, args, retChan)
+		go p.client.HustdbHdel(backend, args, retChan)
 	}
 
 	delSucc := 0
@@ -176,5 +176,5 @@ func (p *HustdbHandler) HustdbHincrby(args map[string][]byte) *comm.HustdbRespon
 	}
 
 	args["host"] = []byte(peers[1])
-	return comm.HustdbHincrby(peers[0], args)
+	return p.client.HustdbHincrby(peers[0], args)
 }
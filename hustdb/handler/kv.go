@@ -23,7 +23,7 @@ func (p *HustdbHandler) HustdbGet2(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbGet2(backend, args, retChan)
+		go p.client.HustdbGet2(backend, args, retChan)
 	}
 
 	maxVer := 0
@@ -49,7 +49,7 @@ func (p *HustdbHandler) HustdbGet(args map[string][]byte) *comm.HustdbResponse {
 
 	backends := peers.FetchHustdbPeers(string(key))
 	for _, backend := range backends {
-		resp := comm.HustdbGet(backend, args)
+		resp := p.client.HustdbGet(backend, args)
 		if resp.Code == comm.HttpOk {
 			return resp
 		}
@@ -77,10 +77,11 @@ func (p *HustdbHandler) HustdbPut(args map[string][]byte) *comm.HustdbResponse {
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbPut(backend, args, val, retChan)
+		go p.client.HustdbPut(backend, args, val, retChan)
 	}
 
 	putSucc := 0
+	maxVer := 0
 	var putFailedBackend string
 	var putSuccessBackend string
 	hustdbResp := &comm.HustdbResponse{Code: 0}
@@ -90,6 +91,10 @@ func (p *HustdbHandler) HustdbPut(args map[string][]byte) *comm.HustdbResponse {
 			putSucc++
 			hustdbResp.Code = comm.HttpOk
 			putSuccessBackend = resp.Backend
+			if resp.Version > maxVer {
+				hustdbResp.Version = resp.Version
+				maxVer = resp.Version
+			}
 		} else {
 			putFailedBackend = resp.Backend
 		}
@@ -113,7 +118,7 @@ func (p *HustdbHandler) HustdbExist(args map[string][]byte) *comm.HustdbResponse
 
 	backends := peers.FetchHustdbPeers(string(key))
 	for _, backend := range backends {
-		resp := comm.HustdbExist(backend, args)
+		resp := p.client.HustdbExist(backend, args)
 		if resp.Code == comm.HttpOk {
 			return resp
 		}
@@ -135,7 +140,7 @@ func (p *HustdbHandler) HustdbDel(args map[string][]byte) *comm.HustdbResponse {
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbDel(backend, args, retChan)
+		go p.client.HustdbDel(backend, args, retChan)
 	}
 
 	delSucc := 0
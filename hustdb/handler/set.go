@@ -24,7 +24,7 @@ func (p *HustdbHandler) HustdbSadd(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbSadd(backend, args, key, retChan)
+		go p.client.HustdbSadd(backend, args, key, retChan)
 	}
 
 	putSucc := 0
@@ -68,7 +68,7 @@ func (p *HustdbHandler) HustdbSismember(args map[string][]byte) *comm.HustdbResp
 
 	backends := peers.FetchHustdbPeers(string(key))
 	for _, backend := range backends {
-		resp := comm.HustdbSismember(backend, args, key)
+		resp := p.client.HustdbSismember(backend, args, key)
 		if resp.Code == comm.HttpOk {
 			return resp
 		}
@@ -95,7 +95,7 @@ func (p *HustdbHandler) HustdbSrem(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbSrem(backend, args, key, retChan)
+		go p.client.HustdbSrem(backend, args, key, retChan)
 	}
 
 	delSucc := 0
@@ -19,7 +19,7 @@ func (p *HustdbHandler) HustdbZismember(args map[string][]byte) *comm.HustdbResp
 
 	backends := peers.FetchHustdbPeers(string(tb))
 	for _, backend := range backends {
-		resp := comm.HustdbZismember(backend, args, key)
+		resp := p.client.HustdbZismember(backend, args, key)
 		if resp.Code == comm.HttpOk {
 			return resp
 		}
@@ -46,7 +46,7 @@ func (p *HustdbHandler) HustdbZscore2(args map[string][]byte) *comm.HustdbRespon
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbZscore2(backend, args, key, retChan)
+		go p.client.HustdbZscore2(backend, args, key, retChan)
 	}
 
 	maxVer := 0
@@ -80,7 +80,7 @@ func (p *HustdbHandler) HustdbZscore(args map[string][]byte) *comm.HustdbRespons
 
 	hustdbResp := &comm.HustdbResponse{Code: 0}
 	for _, backend := range backends {
-		resp := comm.HustdbZscore(backend, args, key)
+		resp := p.client.HustdbZscore(backend, args, key)
 
 		if resp.Code == comm.HttpOk {
 			return resp
@@ -108,7 +108,7 @@ func (p *HustdbHandler) HustdbZadd(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbZadd(backend, args, key, retChan)
+		go p.client.HustdbZadd(backend, args, key, retChan)
 	}
 
 	putSucc := 0
@@ -159,7 +159,7 @@ func (p *HustdbHandler) HustdbZrangebyscore(args map[string][]byte) *comm.Hustdb
 	}
 
 	for _, backend := range backends {
-		code, body := comm.HustdbZrangebyscore(backend, args)
+		code, body := p.client.HustdbZrangebyscore(backend, args)
 		if code == comm.HttpOk {
 			return &comm.HustdbResponse{Code: comm.HttpOk, Data: body}
 		}
@@ -186,7 +186,7 @@ func (p *HustdbHandler) HustdbZrem(args map[string][]byte) *comm.HustdbResponse
 
 	retChan := make(chan *comm.HustdbResponse, len(backends))
 	for _, backend := range backends {
-		go comm.HustdbZrem(backend, args, key, retChan)
+		go p.client.HustdbZrem(backend, args, key, retChan)
 	}
 
 	delSucc := 0
@@ -223,7 +223,7 @@ func (p *HustdbHandler) HustdbZrangebyrank(args map[string][]byte) *comm.HustdbR
 	}
 
 	for _, backend := range backends {
-		code, body := comm.HustdbZrangebyrank(backend, args)
+		code, body := p.client.HustdbZrangebyrank(backend, args)
 		if code == comm.HttpOk {
 			return &comm.HustdbResponse{Code: comm.HttpOk, Data: body}
 		}
@@ -1,6 +1,7 @@
 package healthcheck
 
 import (
+	"sync"
 	"time"
 
 	"../comm"
@@ -13,11 +14,39 @@ var (
 	HealthCheckCycle time.Duration
 )
 
+var cycleChan = make(chan time.Duration, 1)
+
+var (
+	failuresLock sync.Mutex
+	// failed checks, by backend
+	failures = map[string]uint64{}
+)
+
+// Failures returns the number of failed checks of each backend.
+func Failures() map[string]uint64 {
+	failuresLock.Lock()
+	defer failuresLock.Unlock()
+	cp := make(map[string]uint64, len(failures))
+	for host, n := range failures {
+		cp[host] = n
+	}
+	return cp
+}
+
 func Init(cycle int) {
 	HealthCheckCycle = time.Duration(cycle)
 	HealthCheckLoop()
 }
 
+// SetCycle changes the check interval of the running loop.
+func SetCycle(cycle int) {
+	select {
+	case <-cycleChan:
+	default:
+	}
+	cycleChan <- time.Duration(cycle)
+}
+
 type PeerStatusInfo struct {
 	Idx   int
 	Role  string
@@ -27,16 +56,27 @@ type PeerStatusInfo struct {
 
 func RefreshGlobalHaTable(peer *PeerStatusInfo, status bool) bool {
 	peers.HaTable.Rwlock.Lock()
+	defer peers.HaTable.Rwlock.Unlock()
+	// the table may have been reloaded while the check was running
+	if peer.Idx >= len(peers.HaTable.HashTable) {
+		return false
+	}
+	backends := peers.HaTable.HashTable[peer.Idx].Backends
 	switch peer.Role {
 	case "master":
-		peers.HaTable.HashTable[peer.Idx].Backends.Master.Alive = status
+		if backends.Master.Host != peer.Host {
+			return false
+		}
+		backends.Master.Alive = status
 	case "slave":
-		peers.HaTable.HashTable[peer.Idx].Backends.Slave.Alive = status
+		if backends.Slave.Host != peer.Host {
+			return false
+		}
+		backends.Slave.Alive = status
 	default:
 		break
 	}
 
-	peers.HaTable.Rwlock.Unlock()
 	return true
 }
 
@@ -90,8 +130,17 @@ func CheckOnce() {
 func HealthCheckLoop() {
 	ticker := time.NewTicker(time.Second * HealthCheckCycle)
 	go func() {
-		for _ = range ticker.C {
-			CheckOnce()
+		for {
+			select {
+			case <-ticker.C:
+				CheckOnce()
+			case cycle := <-cycleChan:
+				if cycle > 0 && cycle != HealthCheckCycle {
+					seelog.Infof("health check cycle %ds -> %ds", HealthCheckCycle, cycle)
+					HealthCheckCycle = cycle
+					ticker.Reset(time.Second * HealthCheckCycle)
+				}
+			}
 		}
 	}()
 }
@@ -99,6 +148,11 @@ func HealthCheckLoop() {
 func IsAlive(peer *PeerStatusInfo, retChan chan bool, callback func(peer *PeerStatusInfo, status bool) bool) {
 	defer comm.Protect()
 	code := comm.HustdbAlive(peer.Host)
+	if code != comm.HttpOk {
+		failuresLock.Lock()
+		failures[peer.Host]++
+		failuresLock.Unlock()
+	}
 	if code != comm.HttpOk && peer.Alive {
 		retChan <- callback(peer, false)
 	} else if code == comm.HttpOk && !peer.Alive {
@@ -1,8 +1,10 @@
 package peers
 
 import (
+	"path/filepath"
 	"sync"
 
+	def "../../internal/defines"
 	"../../internal/utils"
 	"../comm"
 
@@ -30,7 +32,8 @@ type BackendInfo struct {
 }
 
 type HustdbTable struct {
-	Table []*HustdbItem `json:"table,omitempty"`
+	Table    []*HustdbItem               `json:"table,omitempty"`
+	Backends map[string]*def.BackendConf `json:"backends,omitempty"`
 }
 
 type HustdbItem struct {
@@ -61,7 +64,14 @@ var hustdbTable *HustdbTable
 
 func LoadHustdbTable(path string) bool {
 	hustdbTable = new(HustdbTable)
-	return utils.LoadConf(path, hustdbTable)
+	if !utils.LoadConf(path, hustdbTable) {
+		return false
+	}
+	if err := comm.SetBackendConfs(hustdbTable.Backends, filepath.Dir(path)); err != nil {
+		seelog.Critical(err)
+		return false
+	}
+	return true
 }
 
 func GenHashTable() bool {
@@ -131,8 +141,8 @@ func GenGlobleHashtable() bool {
 }
 
 func RefreshGlobleHashtable() bool {
-	HaTable.Rwlock.RLock()
-	defer HaTable.Rwlock.RUnlock()
+	HaTable.Rwlock.Lock()
+	defer HaTable.Rwlock.Unlock()
 	for _, peer := range HaTable.HashTable {
 		if len(peer.Region) != 2 {
 			seelog.Critical("Globalhashtable Format Error")
@@ -2,9 +2,17 @@ package peers
 
 import "../../internal/utils"
 
-func FetchHustdbMaster(key string) string {
+// backendsOf returns the pair serving the key. The table is read under the
+// lock because Reload may swap it.
+func backendsOf(key string) BackendInfo {
 	index := utils.LocateHashRegion(key)
-	backendInfo := (*globalhashtable)[index]
+	HaTable.Rwlock.RLock()
+	defer HaTable.Rwlock.RUnlock()
+	return (*globalhashtable)[index]
+}
+
+func FetchHustdbMaster(key string) string {
+	backendInfo := backendsOf(key)
 	if backendInfo.Master.Alive {
 		return backendInfo.Master.Host
 	}
@@ -13,8 +21,7 @@ func FetchHustdbMaster(key string) string {
 }
 
 func FetchHustdbSlaver(key string) string {
-	index := utils.LocateHashRegion(key)
-	backendInfo := (*globalhashtable)[index]
+	backendInfo := backendsOf(key)
 	if backendInfo.Slave.Alive {
 		return backendInfo.Slave.Host
 	}
@@ -23,8 +30,7 @@ func FetchHustdbSlaver(key string) string {
 }
 
 func FetchHustdbPeers(key string) []string {
-	index := utils.LocateHashRegion(key)
-	backendInfo := (*globalhashtable)[index]
+	backendInfo := backendsOf(key)
 
 	backends := make([]string, 0, 2)
 	if backendInfo.Master.Alive {
@@ -38,8 +44,7 @@ func FetchHustdbPeers(key string) []string {
 }
 
 func FetchHustdbHincrbyPeers(key string) []string {
-	index := utils.LocateHashRegion(key)
-	backendInfo := (*globalhashtable)[index]
+	backendInfo := backendsOf(key)
 	if backendInfo.Master.Alive {
 		return []string{backendInfo.Master.Host, backendInfo.Slave.Host}
 	}
@@ -83,3 +88,17 @@ func FetchHustdbStatPeers() []string {
 
 	return peers
 }
+
+// Snapshot copies the region table so callers can inspect it without
+// holding the lock.
+func Snapshot() []PeerInfo {
+	HaTable.Rwlock.RLock()
+	defer HaTable.Rwlock.RUnlock()
+
+	peers := make([]PeerInfo, 0, len(HaTable.HashTable))
+	for _, peer := range HaTable.HashTable {
+		backends := *peer.Backends
+		peers = append(peers, PeerInfo{Region: peer.Region, Backends: &backends})
+	}
+	return peers
+}
@@ -0,0 +1,97 @@
+package peers
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"../../internal/utils"
+	"../comm"
+
+	"github.com/cihub/seelog"
+)
+
+// Reload re-reads the region table and swaps it in when it is valid. A
+// backend that is still listed keeps the alive state the health check gave
+// it, new backends start alive like they do in Init.
+func Reload(path string) error {
+	table := new(HustdbTable)
+	if !utils.LoadConf(path, table) {
+		return fmt.Errorf("can not load %s", path)
+	}
+	if err := ValidateHustdbTable(table); err != nil {
+		return err
+	}
+	// credentials and TLS settings apply at once, the regions below
+	if err := comm.SetBackendConfs(table.Backends, filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	HaTable.Rwlock.Lock()
+	defer HaTable.Rwlock.Unlock()
+
+	alive := map[string]bool{}
+	for _, peer := range HaTable.HashTable {
+		alive[peer.Backends.Master.Host] = peer.Backends.Master.Alive
+		alive[peer.Backends.Slave.Host] = peer.Backends.Slave.Alive
+	}
+	hashTable := make([]*PeerInfo, 0, len(table.Table))
+	for _, item := range table.Table {
+		peer, _ := HustdbItem2PeerInfo(item)
+		if state, ok := alive[peer.Backends.Master.Host]; ok {
+			peer.Backends.Master.Alive = state
+		}
+		if state, ok := alive[peer.Backends.Slave.Host]; ok {
+			peer.Backends.Slave.Alive = state
+		}
+		hashTable = append(hashTable, peer)
+	}
+	ghTable := make([]BackendInfo, comm.HustdbTableSize)
+	for _, peer := range hashTable {
+		for ix := peer.Region[0]; ix < peer.Region[1]; ix++ {
+			ghTable[ix] = *peer.Backends
+		}
+	}
+
+	hustdbTable = table
+	HaTable.HashTable = hashTable
+	globalhashtable = &ghTable
+	seelog.Infof("region table reloaded from %s, %d regions", path, len(hashTable))
+	return nil
+}
+
+// ValidateHustdbTable checks that the regions are well formed and cover
+// the whole hash space exactly once.
+func ValidateHustdbTable(table *HustdbTable) error {
+	if len(table.Table) == 0 {
+		return fmt.Errorf("region table is empty")
+	}
+	regions := make([][]int, 0, len(table.Table))
+	for idx, item := range table.Table {
+		if len(item.Item.Key) != 2 || len(item.Item.Val) != 2 {
+			return fmt.Errorf("item %d: want 2 keys and 2 vals", idx)
+		}
+		start, end := item.Item.Key[0], item.Item.Key[1]
+		if start < 0 || end > comm.HustdbTableSize || start >= end {
+			return fmt.Errorf("item %d: bad region [%d, %d)", idx, start, end)
+		}
+		if item.Item.Val[0] == "" || item.Item.Val[1] == "" {
+			return fmt.Errorf("item %d: empty backend", idx)
+		}
+		regions = append(regions, item.Item.Key)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i][0] < regions[j][0]
+	})
+	next := 0
+	for _, region := range regions {
+		if region[0] != next {
+			return fmt.Errorf("regions do not cover [%d, %d) exactly once", next, region[0])
+		}
+		next = region[1]
+	}
+	if next != comm.HustdbTableSize {
+		return fmt.Errorf("regions do not cover [%d, %d)", next, comm.HustdbTableSize)
+	}
+	return nil
+}
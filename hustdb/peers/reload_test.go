@@ -0,0 +1,105 @@
+package peers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"../comm"
+)
+
+// regionTable builds a table with one item per region, backed by
+// master and slave.
+func regionTable(master, slave string, regions ...[2]int) *HustdbTable {
+	table := &HustdbTable{}
+	for _, region := range regions {
+		item := &HustdbItem{}
+		item.Item.Key = []int{region[0], region[1]}
+		item.Item.Val = []string{master, slave}
+		table.Table = append(table.Table, item)
+	}
+	return table
+}
+
+func TestValidateHustdbTable(t *testing.T) {
+	const size = comm.HustdbTableSize
+	tests := []struct {
+		name  string
+		table *HustdbTable
+		// a part of the error, "" for a valid table
+		err string
+	}{
+		{"whole", regionTable("m:1", "s:1", [2]int{0, size}), ""},
+		{"split", regionTable("m:1", "s:1", [2]int{0, 512}, [2]int{512, size}), ""},
+		{"unordered", regionTable("m:1", "s:1", [2]int{512, size}, [2]int{0, 512}), ""},
+		{"empty", &HustdbTable{}, "empty"},
+		{"gap", regionTable("m:1", "s:1", [2]int{0, 500}, [2]int{512, size}), "do not cover [500, 512)"},
+		{"short", regionTable("m:1", "s:1", [2]int{0, 512}), "do not cover [512, 1024)"},
+		{"missing start", regionTable("m:1", "s:1", [2]int{1, size}), "do not cover [0, 1)"},
+		{"overlap", regionTable("m:1", "s:1", [2]int{0, 600}, [2]int{512, size}), "exactly once"},
+		{"duplicate", regionTable("m:1", "s:1", [2]int{0, size}, [2]int{0, size}), "exactly once"},
+		{"negative", regionTable("m:1", "s:1", [2]int{-1, size}), "bad region"},
+		{"past the end", regionTable("m:1", "s:1", [2]int{0, size + 1}), "bad region"},
+		{"reversed", regionTable("m:1", "s:1", [2]int{size, 0}), "bad region"},
+		{"zero width", regionTable("m:1", "s:1", [2]int{0, 0}, [2]int{0, size}), "bad region"},
+		{"no backend", regionTable("m:1", "", [2]int{0, size}), "empty backend"},
+	}
+	for _, tt := range tests {
+		err := ValidateHustdbTable(tt.table)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.err != "" && err == nil:
+			t.Errorf("%s: no error, want %q", tt.name, tt.err)
+		case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+			t.Errorf("%s: error %q, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func writeTable(t *testing.T, path string, table *HustdbTable) {
+	data, err := json.Marshal(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backends.json")
+	writeTable(t, path, regionTable("m:1", "s:1", [2]int{0, comm.HustdbTableSize}))
+	if !Init(path) {
+		t.Fatal("Init failed")
+	}
+	// the health check found the slave down
+	HaTable.HashTable[0].Backends.Slave.Alive = false
+
+	// an invalid table leaves the current one live
+	writeTable(t, path, regionTable("m:2", "s:2", [2]int{0, 512}))
+	if err := Reload(path); err == nil {
+		t.Fatal("Reload of a table with a gap succeeded")
+	}
+	if master := FetchHustdbMaster("key"); master != "m:1" {
+		t.Errorf("master after a failed reload = %q, want m:1", master)
+	}
+
+	writeTable(t, path, regionTable("s:1", "m:2", [2]int{0, 512}, [2]int{512, comm.HustdbTableSize}))
+	if err := Reload(path); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(HaTable.HashTable) != 2 {
+		t.Fatalf("%d regions after reload, want 2", len(HaTable.HashTable))
+	}
+	for _, peer := range HaTable.HashTable {
+		if peer.Backends.Master.Host != "s:1" || peer.Backends.Master.Alive {
+			t.Errorf("region %v: master %+v, want s:1 still down", peer.Region, peer.Backends.Master)
+		}
+		if peer.Backends.Slave.Host != "m:2" || !peer.Backends.Slave.Alive {
+			t.Errorf("region %v: slave %+v, want m:2 alive", peer.Region, peer.Backends.Slave)
+		}
+	}
+}
@@ -1,8 +1,63 @@
 package defines
 
 type ServerConf struct {
-	Id   int
-	Port int
+	Id          int
+	Port        int
+	RequirePass string
+	AclFile     string
+	// seconds to wait for clients and binlog tasks on shutdown
+	ShutdownTimeout int
+	Tls             TlsConf
+	// addresses Port and Tls.Port are bound on, all interfaces when empty
+	Bind       []string
+	UnixSocket string
+	// octal, like "770", default "700"
+	UnixSocketPerm string
+	// 0 means no limit
+	MaxClients int
+	// seconds a client may stay idle, 0 disables the timeout
+	Timeout int
+	// seconds between TCP keepalive probes, 0 disables them
+	TcpKeepAlive int
+	// defaults to true
+	TcpNoDelay *bool
+	// protocol limits in bytes and elements, 0 means the redis default:
+	// 512MB, 1M and 1GB
+	ProtoMaxBulkLen        int
+	MaxMultiBulkLen        int
+	ClientQueryBufferLimit int
+	// limits on the replies waiting for a client, subscribers have their own
+	OutputBufferLimit       OutputBufferLimit
+	PubSubOutputBufferLimit OutputBufferLimit
+	// bytes of replies buffered before they are written, default 64KB
+	OutputFlushThreshold int
+	// microseconds a command runs before it is logged, default 10000, a
+	// negative value disables the slow log and 0 logs every command
+	SlowlogLogSlowerThan *int
+	// entries kept, default 128
+	SlowlogMaxLen int
+	// address of the prometheus /metrics listener, disabled when empty
+	MetricsAddr string
+}
+
+// OutputBufferLimit disconnects a client whose pending replies pass Hard
+// bytes, or stay above Soft bytes for SoftSeconds. Zero disables a limit.
+type OutputBufferLimit struct {
+	Hard        int
+	Soft        int
+	SoftSeconds int
+}
+
+// TlsConf configures the TLS listener, a zero Port disables it. A zero
+// ServerConf.Port with TLS enabled makes the proxy TLS only.
+type TlsConf struct {
+	Port     int
+	CertFile string
+	KeyFile  string
+	// CA bundle for client certificates, enables mutual TLS
+	ClientCA string
+	// "1.0" to "1.3", default "1.2"
+	MinVersion string
 }
 
 type HttpConf struct {
@@ -26,3 +81,17 @@ type HealthCheckConf struct {
 	HealthCheckCycle int
 	Timeout          int
 }
+
+// BackendConf is the optional per backend section of backends.json. Backends
+// without one are reached over plain http with the Hustdb credentials.
+type BackendConf struct {
+	// "http" or "https"
+	Scheme string `json:"scheme,omitempty"`
+	// CA bundle to verify the backend with, system roots when empty
+	CaFile     string `json:"ca,omitempty"`
+	CertFile   string `json:"cert,omitempty"`
+	KeyFile    string `json:"key,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+	User       string `json:"user,omitempty"`
+	Passwd     string `json:"passwd,omitempty"`
+}
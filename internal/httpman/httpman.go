@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	seelog "github.com/cihub/seelog"
@@ -23,24 +24,48 @@ var hcClient *http.Client
 
 var session *Session
 
+// lock guards the clients and dial settings, which ApplyHttp replaces at
+// runtime
+var lock sync.RWMutex
+
 var (
 	timeout   int
 	hctimeout int
 	keepalive int
+	// TLS settings of the backends that have their own, by host:port
+	tlsConfigs map[string]*tls.Config
 )
 
 func InitHttp(httpConfig def.HttpConf, hctimeout int) {
-	timeout, keepalive = httpConfig.Timeout, httpConfig.KeepAlive
-	session = NewSession(httpConfig.MaxIdleConnsPerHost, httpConfig.ResponseHeaderTimeout)
-	hcClient = &http.Client{
+	ApplyHttp(httpConfig, hctimeout)
+}
+
+// ApplyHttp switches to clients built from the new settings. Requests in
+// flight finish on the old clients, whose idle connections are dropped.
+func ApplyHttp(httpConfig def.HttpConf, healthCheckTimeout int) {
+	newSession := NewSession(httpConfig.MaxIdleConnsPerHost, httpConfig.ResponseHeaderTimeout)
+	newHcClient := &http.Client{
 		Transport: &http.Transport{
 			Dial:                  dialTimeout,
+			DialTLS:               dialTLSTimeout,
 			DisableKeepAlives:     false,
 			MaxIdleConnsPerHost:   httpConfig.MaxIdleConnsPerHost,
-			ResponseHeaderTimeout: time.Duration(hctimeout) * time.Second,
+			ResponseHeaderTimeout: time.Duration(healthCheckTimeout) * time.Second,
 			TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
 		},
 	}
+
+	lock.Lock()
+	oldSession, oldHcClient := session, hcClient
+	timeout, keepalive = httpConfig.Timeout, httpConfig.KeepAlive
+	hctimeout = healthCheckTimeout
+	session, hcClient = newSession, newHcClient
+	lock.Unlock()
+
+	if oldSession != nil {
+		oldSession.Client.Transport.(*http.Transport).CloseIdleConnections()
+		oldHcClient.Transport.(*http.Transport).CloseIdleConnections()
+	}
 }
 
 func NewSession(conn, timeout int) *Session {
@@ -48,6 +73,7 @@ func NewSession(conn, timeout int) *Session {
 		Client: &http.Client{
 			Transport: &http.Transport{
 				Dial:                  localDial,
+				DialTLS:               localDialTLS,
 				DisableKeepAlives:     false,
 				MaxIdleConnsPerHost:   conn,
 				ResponseHeaderTimeout: time.Duration(timeout) * time.Second,
@@ -59,9 +85,17 @@ func NewSession(conn, timeout int) *Session {
 }
 
 func GetSession() *Session {
+	lock.RLock()
+	defer lock.RUnlock()
 	return session
 }
 
+func getHcClient() *http.Client {
+	lock.RLock()
+	defer lock.RUnlock()
+	return hcClient
+}
+
 func HttpBasicWithHeader(url, method string, data []byte, headers map[string]string, username, passwd string, shorttimeout bool) (int, []byte, http.Header) {
 	defer Protect()
 	var body io.Reader
@@ -85,11 +119,13 @@ func HttpBasicWithHeader(url, method string, data []byte, headers map[string]str
 	if !shorttimeout {
 		client = GetSession().Client
 	} else {
-		client = hcClient
+		client = getHcClient()
 	}
 
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		record(req.URL.Host, 0, time.Since(start))
 		seelog.Errorf("Client_Do: %v", err)
 		return http.StatusInternalServerError, nil, nil
 	}
@@ -97,9 +133,11 @@ func HttpBasicWithHeader(url, method string, data []byte, headers map[string]str
 
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
+		record(req.URL.Host, 0, time.Since(start))
 		seelog.Errorf("Read_Response_Body_Error: %v", err)
 		return http.StatusInternalServerError, nil, nil
 	}
+	record(req.URL.Host, resp.StatusCode, time.Since(start))
 	return resp.StatusCode, respBody, resp.Header
 }
 
@@ -112,15 +150,89 @@ func HttpBasicWithTimeout(url, method string, data []byte, headers map[string]st
 }
 
 func localDial(network, addr string) (net.Conn, error) {
+	lock.RLock()
 	dial := net.Dialer{
 		Timeout:   time.Duration(timeout) * time.Second,
 		KeepAlive: time.Duration(keepalive) * time.Second,
 	}
+	lock.RUnlock()
 	return dial.Dial(network, addr)
 }
 
 func dialTimeout(network, addr string) (net.Conn, error) {
-	return net.DialTimeout(network, addr, time.Second*time.Duration(hctimeout))
+	lock.RLock()
+	d := time.Second * time.Duration(hctimeout)
+	lock.RUnlock()
+	return net.DialTimeout(network, addr, d)
+}
+
+// SetTLSConfigs replaces the per backend TLS settings. Idle connections are
+// dropped so the next request to a backend handshakes with its new config.
+func SetTLSConfigs(configs map[string]*tls.Config) {
+	lock.Lock()
+	tlsConfigs = configs
+	clients := []*http.Client{hcClient}
+	if session != nil {
+		clients = append(clients, session.Client)
+	}
+	lock.Unlock()
+
+	for _, client := range clients {
+		if client != nil {
+			client.Transport.(*http.Transport).CloseIdleConnections()
+		}
+	}
+}
+
+// tlsConfigFor returns the config of the backend, backends without one keep
+// the old behaviour of not verifying the certificate.
+func tlsConfigFor(addr string) *tls.Config {
+	lock.RLock()
+	config, ok := tlsConfigs[addr]
+	lock.RUnlock()
+	if !ok {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	return config
+}
+
+func handshake(conn net.Conn, addr string, timeout time.Duration) (net.Conn, error) {
+	tlsConn := tls.Client(conn, tlsConfigFor(addr))
+	if timeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+func localDialTLS(network, addr string) (net.Conn, error) {
+	conn, err := localDial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	lock.RLock()
+	d := time.Duration(timeout) * time.Second
+	lock.RUnlock()
+	return handshake(conn, addr, d)
+}
+
+func dialTLSTimeout(network, addr string) (net.Conn, error) {
+	conn, err := dialTimeout(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	lock.RLock()
+	d := time.Duration(hctimeout) * time.Second
+	lock.RUnlock()
+	return handshake(conn, addr, d)
 }
 
 func Protect() {
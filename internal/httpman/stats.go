@@ -0,0 +1,97 @@
+package httpman
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the buckets the
+// request latencies are counted in.
+var LatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// BackendStats counts the requests sent to one backend.
+type BackendStats struct {
+	Backend string
+	// requests answered, by status code
+	Codes map[int]uint64
+	// requests that got no response
+	Errors uint64
+	// requests per latency bucket, the last one counting those slower than
+	// every bound
+	Buckets []uint64
+	Count   uint64
+	Elapsed time.Duration
+}
+
+type backendStats struct {
+	sync.Mutex
+	BackendStats
+}
+
+var (
+	statsLock sync.RWMutex
+	stats     = map[string]*backendStats{}
+)
+
+func statsOf(backend string) *backendStats {
+	statsLock.RLock()
+	st, ok := stats[backend]
+	statsLock.RUnlock()
+	if ok {
+		return st
+	}
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	if st, ok = stats[backend]; !ok {
+		st = &backendStats{BackendStats: BackendStats{
+			Backend: backend,
+			Codes:   map[int]uint64{},
+			Buckets: make([]uint64, len(LatencyBuckets)+1),
+		}}
+		stats[backend] = st
+	}
+	return st
+}
+
+// record accounts a request to backend, code being 0 when it got no response.
+func record(backend string, code int, elapsed time.Duration) {
+	st := statsOf(backend)
+	secs := elapsed.Seconds()
+	bucket := sort.SearchFloat64s(LatencyBuckets, secs)
+	st.Lock()
+	if code == 0 {
+		st.Errors++
+	} else {
+		st.Codes[code]++
+	}
+	st.Buckets[bucket]++
+	st.Count++
+	st.Elapsed += elapsed
+	st.Unlock()
+}
+
+// Stats returns a copy of the counters of every backend requested so far,
+// sorted by backend.
+func Stats() []BackendStats {
+	statsLock.RLock()
+	all := make([]*backendStats, 0, len(stats))
+	for _, st := range stats {
+		all = append(all, st)
+	}
+	statsLock.RUnlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Backend < all[j].Backend })
+	list := make([]BackendStats, 0, len(all))
+	for _, st := range all {
+		st.Lock()
+		cp := st.BackendStats
+		cp.Codes = make(map[int]uint64, len(st.Codes))
+		for code, n := range st.Codes {
+			cp.Codes[code] = n
+		}
+		cp.Buckets = append([]uint64(nil), st.Buckets...)
+		st.Unlock()
+		list = append(list, cp)
+	}
+	return list
+}
@@ -33,3 +33,12 @@ func LoadGlobalConf(path string) bool {
 func GetGlobalConf() *HaConf {
 	return globalhaconfig
 }
+
+// LoadHaConf parses a server.json without touching the global one.
+func LoadHaConf(path string) (*HaConf, bool) {
+	conf := new(HaConf)
+	if !LoadConf(path, conf) {
+		return nil, false
+	}
+	return conf, true
+}
@@ -0,0 +1,84 @@
+package utils
+
+// GlobMatch reports whether str matches the redis style glob pattern.
+// Supported: '*', '?', '[abc]', '[^abc]', '[a-z]' and '\' escaping.
+//
+// Only the last '*' is ever backtracked to: whatever an earlier one would
+// take differently, the later one can take as well. That keeps the match
+// in O(len(pattern)*len(str)) for patterns that come from clients.
+func GlobMatch(pattern, str []byte) bool {
+	p, s := 0, 0
+	// the pattern after the last '*' and where its match in str starts,
+	// star is -1 before the first one
+	star, next := -1, 0
+	for s < len(str) {
+		if p < len(pattern) && pattern[p] == '*' {
+			p++
+			star, next = p, s
+			continue
+		}
+		if p < len(pattern) {
+			if n, ok := matchOne(pattern[p:], str[s]); ok {
+				p += n
+				s++
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		// let the last '*' take one more byte
+		next++
+		p, s = star, next
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchOne matches c against the first element of pattern, which is not a
+// '*', and returns the length of the element.
+func matchOne(pattern []byte, c byte) (int, bool) {
+	switch pattern[0] {
+	case '?':
+		return 1, true
+	case '[':
+		i := 1
+		not := i < len(pattern) && pattern[i] == '^'
+		if not {
+			i++
+		}
+		match := false
+		for i < len(pattern) && pattern[i] != ']' {
+			if pattern[i] == '\\' && i+1 < len(pattern) {
+				i++
+				if pattern[i] == c {
+					match = true
+				}
+			} else if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+				start, end := pattern[i], pattern[i+2]
+				if start > end {
+					start, end = end, start
+				}
+				if c >= start && c <= end {
+					match = true
+				}
+				i += 2
+			} else if pattern[i] == c {
+				match = true
+			}
+			i++
+		}
+		if i == len(pattern) {
+			// unterminated class never matches
+			return 0, false
+		}
+		return i + 1, match != not
+	case '\\':
+		if len(pattern) > 1 {
+			return 2, pattern[1] == c
+		}
+	}
+	return 1, pattern[0] == c
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"ab", "abc", false},
+
+		{"*", "", true},
+		{"*", "anything", true},
+		{"**", "", true},
+		{"a*", "a", true},
+		{"a*", "abc", true},
+		{"a*", "bac", false},
+		{"*c", "abc", true},
+		{"*c", "abcd", false},
+		{"a*c", "ac", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abcbd", false},
+		{"a*b*c", "axbyc", true},
+		{"a*b*c", "axcyb", false},
+		{"*ab*", "xxaxabx", true},
+		{"news.*", "news.tech", true},
+
+		{"?", "a", true},
+		{"?", "", false},
+		{"?", "ab", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*?", "", false},
+		{"*?", "a", true},
+
+		{"[abc]", "b", true},
+		{"[abc]", "d", false},
+		{"[abc]", "", false},
+		{"[a-c]x", "bx", true},
+		{"[c-a]", "b", true},
+		{"[a-c]", "d", false},
+		{"[a-]", "-", true},
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hillo", false},
+		{"[abc", "a", false},
+		{"*[abc", "xa", false},
+		{"[]", "a", false},
+
+		{"[^abc]", "d", true},
+		{"[^abc]", "a", false},
+		{"[^a-c]", "b", false},
+		{"[^a-c]", "z", true},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`\?`, "?", true},
+		{`\?`, "a", false},
+		{`a\[b`, "a[b", true},
+		{`[\]]`, "]", true},
+		{`[\^a]`, "^", true},
+		{`[a\-z]`, "-", true},
+		{`[a\-z]`, "b", false},
+		{`\`, `\`, true},
+		{`a\`, `a\`, true},
+		{`\a`, "a", true},
+	}
+	for _, tt := range tests {
+		if got := GlobMatch([]byte(tt.pattern), []byte(tt.str)); got != tt.match {
+			t.Errorf("GlobMatch(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.match)
+		}
+	}
+}
+
+func TestGlobMatchManyStars(t *testing.T) {
+	// exponential for a matcher backtracking to every '*'
+	pattern := []byte(strings.Repeat("a*", 30) + "b")
+	str := []byte(strings.Repeat("a", 100))
+	start := time.Now()
+	if GlobMatch(pattern, str) {
+		t.Errorf("GlobMatch(%q, %q) = true", pattern, str)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GlobMatch took %v", elapsed)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"./hustdb/peers"
+	def "./internal/defines"
 	"./internal/httpman"
 	"./internal/utils"
 
@@ -14,7 +15,11 @@ import (
 
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cihub/seelog"
 
@@ -56,6 +61,7 @@ func main() {
 	}
 
 	gconf := utils.GetGlobalConf()
+	resolvePaths(&gconf.Server, conf)
 
 	seelog.Debugf("global conf :%v\n", gconf)
 
@@ -69,9 +75,97 @@ func main() {
 		return
 	}
 
-	srv, err := server.NewServer(fmt.Sprintf(":%d", gconf.Server.Port), gconf.Concurrency)
+	srv, err := server.NewServer(&gconf.Server, gconf.Concurrency)
 	if err != nil {
-		panic(err)
+		// a configuration error, not worth a stack trace
+		seelog.Criticalf("can not start the server: %v", err)
+		seelog.Flush()
+		os.Exit(1)
+	}
+	srv.SetReloader(func() error {
+		return reload(srv, cfpath, bpath)
+	})
+	go func() {
+		if err := srv.Run(); err != nil {
+			seelog.Criticalf("accept error: %v", err)
+			srv.RequestShutdown()
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for running := true; running; {
+		select {
+		case sig := <-sigs:
+			if sig == syscall.SIGHUP {
+				seelog.Info("received SIGHUP, reloading")
+				srv.Reload()
+				continue
+			}
+			seelog.Infof("received %v, shutting down", sig)
+		case <-srv.ShutdownRequested():
+			seelog.Info("shutdown requested")
+		}
+		running = false
+	}
+	srv.Shutdown(time.Duration(gconf.Server.ShutdownTimeout) * time.Second)
+	seelog.Info("goha stopped")
+}
+
+// reload re-reads server.json and backends.json. The region table is only
+// swapped in once it validates, then the rest is applied: the TLS
+// certificates, requirepass and the acl file, the hustdb, http and health
+// check sections, concurrency, client limits and the slowlog. Settings bound
+// at startup (listen addresses, binlog routines) keep their value.
+func reload(srv *server.Server, cfpath, bpath string) error {
+	conf, ok := utils.LoadHaConf(cfpath)
+	if !ok {
+		return fmt.Errorf("can not load %s", cfpath)
+	}
+	resolvePaths(&conf.Server, filepath.Dir(cfpath))
+	// certificates are checked first, a broken one must not leave the new
+	// region table live with the rest of the reload skipped
+	applyCerts, err := srv.ReloadCerts(&conf.Server.Tls)
+	if err != nil {
+		return err
+	}
+	applyACL, err := srv.ReloadACL(&conf.Server)
+	if err != nil {
+		return err
+	}
+	if err := peers.Reload(bpath); err != nil {
+		return err
+	}
+	applyCerts()
+	applyACL()
+
+	gconf := utils.GetGlobalConf()
+	if conf.Server.Port != gconf.Server.Port || conf.Server.Tls.Port != gconf.Server.Tls.Port ||
+		conf.Server.UnixSocket != gconf.Server.UnixSocket || conf.Server.MetricsAddr != gconf.Server.MetricsAddr ||
+		strings.Join(conf.Server.Bind, ",") != strings.Join(gconf.Server.Bind, ",") {
+		seelog.Warn("listen address changes need a restart")
+	}
+	if conf.Binlog != gconf.Binlog {
+		seelog.Warn("Binlog changes need a restart")
+	}
+	comm.HustdbInit(&conf.Hustdb)
+	httpman.ApplyHttp(conf.Http, conf.HealthCheck.Timeout)
+	hc.SetCycle(conf.HealthCheck.HealthCheckCycle)
+	srv.SetConcurrency(conf.Concurrency)
+	srv.SetClientLimits(&conf.Server)
+	srv.SetSlowlog(&conf.Server)
+	gconf.Hustdb, gconf.Http, gconf.HealthCheck, gconf.Concurrency =
+		conf.Hustdb, conf.Http, conf.HealthCheck, conf.Concurrency
+	seelog.Info("configuration reloaded")
+	return nil
+}
+
+// resolvePaths makes the files named in the server section relative to the
+// conf directory.
+func resolvePaths(sconf *def.ServerConf, dir string) {
+	for _, path := range []*string{&sconf.AclFile, &sconf.UnixSocket, &sconf.Tls.CertFile, &sconf.Tls.KeyFile, &sconf.Tls.ClientCA} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
 	}
-	srv.Run()
 }
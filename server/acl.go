@@ -0,0 +1,537 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	def "../internal/defines"
+	"../internal/utils"
+)
+
+const (
+	defaultUser = "default"
+)
+
+var (
+	aclCategories = []string{"read", "write", "admin", "string", "hash", "set", "zset", "list", "connection", "transaction", "pubsub"}
+
+	errNoAuth = errors.New("NOAUTH Authentication required.")
+)
+
+// aclUser is stored as is in the acl file. Passwords hold sha256 hex digests,
+// Commands are "+@category", "-@category", "+command" or "-command" rules
+// applied in order, and Keys are glob patterns matched against keys and
+// table names.
+type aclUser struct {
+	Name      string
+	Enabled   bool
+	NoPass    bool
+	Passwords []string
+	Commands  []string
+	Keys      []string
+}
+
+type aclFile struct {
+	Users []*aclUser
+}
+
+type ACL struct {
+	rwlock      *sync.RWMutex
+	users       map[string]*aclUser
+	path        string
+	requirePass string
+	// the default user was set by the acl file or ACL SETUSER rather than
+	// built from requirepass, only then does ACL SAVE write it
+	defaultCustom bool
+}
+
+func NewACL(requirePass, path string) (*ACL, error) {
+	acl := &ACL{
+		rwlock:      &sync.RWMutex{},
+		path:        path,
+		requirePass: requirePass,
+	}
+	if err := acl.Load(); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// Load rebuilds the user table from requirepass and the acl file.
+func (acl *ACL) Load() error {
+	acl.rwlock.RLock()
+	requirePass, path := acl.requirePass, acl.path
+	acl.rwlock.RUnlock()
+	apply, err := acl.Reconfigure(requirePass, path)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Reconfigure builds the user table from requirePass and the acl file at
+// path, the returned func makes it and its source current. Nothing changes
+// when the file does not load.
+func (acl *ACL) Reconfigure(requirePass, path string) (func(), error) {
+	defUser := &aclUser{
+		Name:     defaultUser,
+		Enabled:  true,
+		Commands: []string{"+@all"},
+		Keys:     []string{"*"},
+	}
+	if requirePass == "" {
+		defUser.NoPass = true
+	} else {
+		defUser.Passwords = []string{hashPassword([]byte(requirePass))}
+	}
+	users := map[string]*aclUser{defaultUser: defUser}
+	defaultCustom := false
+
+	if path != "" && utils.IsExist(path) {
+		file := &aclFile{}
+		if !utils.LoadConf(path, file) {
+			return nil, fmt.Errorf("ERR failed to load acl file %s", path)
+		}
+		for _, user := range file.Users {
+			if user.Name == "" {
+				return nil, fmt.Errorf("ERR user without name in acl file %s", path)
+			}
+			// canRun compares lowercase names, like ACL SETUSER stores them
+			for i, rule := range user.Commands {
+				user.Commands[i] = strings.ToLower(rule)
+				if !validCommandRule(user.Commands[i]) {
+					return nil, fmt.Errorf("ERR invalid command rule '%s' for user '%s'", rule, user.Name)
+				}
+			}
+			for i, hash := range user.Passwords {
+				if !validPasswordHash(hash) {
+					return nil, fmt.Errorf("ERR invalid password hash '%s' for user '%s'", hash, user.Name)
+				}
+				user.Passwords[i] = strings.ToLower(hash)
+			}
+			users[user.Name] = user
+			if user.Name == defaultUser {
+				defaultCustom = true
+			}
+		}
+	}
+
+	return func() {
+		acl.rwlock.Lock()
+		acl.requirePass, acl.path = requirePass, path
+		acl.users = users
+		acl.defaultCustom = defaultCustom
+		acl.rwlock.Unlock()
+	}, nil
+}
+
+func (acl *ACL) Save() error {
+	file := &aclFile{}
+	acl.rwlock.RLock()
+	path := acl.path
+	if path == "" {
+		acl.rwlock.RUnlock()
+		return errors.New("ERR no acl file is configured")
+	}
+	for _, name := range acl.userNames() {
+		// a default user saved from requirepass would shadow later changes
+		// of requirepass
+		if name == defaultUser && !acl.defaultCustom {
+			continue
+		}
+		file.Users = append(file.Users, acl.users[name])
+	}
+	acl.rwlock.RUnlock()
+	if !utils.SaveConf(file, path) {
+		return fmt.Errorf("ERR failed to save acl file %s", path)
+	}
+	return nil
+}
+
+// ReloadACL re-reads requirepass and the acl file like ReloadCerts does the
+// certificates. Clients keep the user they authenticated as.
+func (s *Server) ReloadACL(conf *def.ServerConf) (func(), error) {
+	return s.acl.Reconfigure(conf.RequirePass, conf.AclFile)
+}
+
+// userNames must be called with rwlock held.
+func (acl *ACL) userNames() []string {
+	names := make([]string, 0, len(acl.users))
+	for name := range acl.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (acl *ACL) getUser(name string) *aclUser {
+	acl.rwlock.RLock()
+	defer acl.rwlock.RUnlock()
+	return acl.users[name]
+}
+
+// DefaultLogin returns the user a new connection is logged in as, or ""
+// when it has to AUTH first.
+func (acl *ACL) DefaultLogin() string {
+	if user := acl.getUser(defaultUser); user != nil && user.Enabled && user.NoPass {
+		return defaultUser
+	}
+	return ""
+}
+
+func (acl *ACL) Authenticate(name string, pass []byte) bool {
+	user := acl.getUser(name)
+	if user == nil || !user.Enabled {
+		return false
+	}
+	if user.NoPass {
+		return true
+	}
+	digest := []byte(hashPassword(pass))
+	for _, p := range user.Passwords {
+		if subtle.ConstantTimeCompare(digest, []byte(p)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Check tells whether the user may run cmd with the given arguments.
+func (acl *ACL) Check(name, cmd string, args [][]byte) error {
+	user := acl.getUser(name)
+	if user == nil || !user.Enabled {
+		return errNoAuth
+	}
+	if !user.canRun(cmd) {
+		return fmt.Errorf("NOPERM this user has no permissions to run the '%s' command", cmd)
+	}
+	for _, key := range commandKeys(cmd, args) {
+		if !user.canAccess(key) {
+			return errors.New("NOPERM this user has no permissions to access one of the keys used as arguments")
+		}
+	}
+	return nil
+}
+
+func (acl *ACL) SetUser(name string, rules [][]byte) error {
+	acl.rwlock.Lock()
+	defer acl.rwlock.Unlock()
+	user := &aclUser{Name: name}
+	if old, ok := acl.users[name]; ok {
+		// copy on write, so readers never see a half applied rule set
+		user.Enabled, user.NoPass = old.Enabled, old.NoPass
+		user.Passwords = append([]string(nil), old.Passwords...)
+		user.Commands = append([]string(nil), old.Commands...)
+		user.Keys = append([]string(nil), old.Keys...)
+	}
+	for _, rule := range rules {
+		if err := user.apply(utils.BytesToString(rule)); err != nil {
+			return fmt.Errorf("ERR Error in ACL SETUSER modifier '%s': %s", rule, err.Error())
+		}
+	}
+	acl.users[name] = user
+	if name == defaultUser {
+		acl.defaultCustom = true
+	}
+	return nil
+}
+
+func (acl *ACL) DelUser(names [][]byte) (int, error) {
+	acl.rwlock.Lock()
+	defer acl.rwlock.Unlock()
+	var cnt int
+	for _, name := range names {
+		if utils.BytesToString(name) == defaultUser {
+			return 0, errors.New("ERR The 'default' user cannot be removed")
+		}
+	}
+	for _, name := range names {
+		if _, ok := acl.users[string(name)]; ok {
+			delete(acl.users, string(name))
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+func (u *aclUser) apply(rule string) error {
+	lower := strings.ToLower(rule)
+	switch {
+	case lower == "on":
+		u.Enabled = true
+	case lower == "off":
+		u.Enabled = false
+	case lower == "nopass":
+		u.NoPass = true
+		u.Passwords = nil
+	case lower == "resetpass":
+		u.NoPass = false
+		u.Passwords = nil
+	case lower == "allkeys":
+		u.Keys = []string{"*"}
+	case lower == "resetkeys":
+		u.Keys = nil
+	case lower == "allcommands":
+		u.Commands = []string{"+@all"}
+	case lower == "nocommands":
+		u.Commands = nil
+	case lower == "reset":
+		*u = aclUser{Name: u.Name}
+	case strings.HasPrefix(rule, ">"):
+		u.NoPass = false
+		u.Passwords = addString(u.Passwords, hashPassword([]byte(rule[1:])))
+	case strings.HasPrefix(rule, "<"):
+		u.Passwords = removeString(u.Passwords, hashPassword([]byte(rule[1:])))
+	case strings.HasPrefix(rule, "#"):
+		if !validPasswordHash(rule[1:]) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.NoPass = false
+		u.Passwords = addString(u.Passwords, strings.ToLower(rule[1:]))
+	case strings.HasPrefix(rule, "!"):
+		u.Passwords = removeString(u.Passwords, strings.ToLower(rule[1:]))
+	case strings.HasPrefix(rule, "~"):
+		u.Keys = addString(u.Keys, rule[1:])
+	case strings.HasPrefix(rule, "+") || strings.HasPrefix(rule, "-"):
+		if !validCommandRule(lower) {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		if lower == "+@all" {
+			u.Commands = []string{lower}
+		} else if lower == "-@all" {
+			u.Commands = nil
+		} else {
+			u.Commands = append(u.Commands, lower)
+		}
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+func (u *aclUser) canRun(cmd string) bool {
+	allowed := false
+	for _, rule := range u.Commands {
+		grant := rule[0] == '+'
+		name := rule[1:]
+		if name == "@all" || name == cmd {
+			allowed = grant
+		} else if name[0] == '@' && inCategory(cmd, name[1:]) {
+			allowed = grant
+		}
+	}
+	return allowed
+}
+
+func (u *aclUser) canAccess(key []byte) bool {
+	for _, pattern := range u.Keys {
+		if utils.GlobMatch([]byte(pattern), key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) flags() []string {
+	flags := []string{"off"}
+	if u.Enabled {
+		flags[0] = "on"
+	}
+	if len(u.Keys) == 1 && u.Keys[0] == "*" {
+		flags = append(flags, "allkeys")
+	}
+	if len(u.Commands) == 1 && u.Commands[0] == "+@all" {
+		flags = append(flags, "allcommands")
+	}
+	if u.NoPass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+func (u *aclUser) commands() string {
+	if len(u.Commands) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.Commands, " ")
+}
+
+// describe renders the user the way ACL LIST does.
+func (u *aclUser) describe() string {
+	parts := []string{"user", u.Name, "off"}
+	if u.Enabled {
+		parts[2] = "on"
+	}
+	if u.NoPass {
+		parts = append(parts, "nopass")
+	}
+	for _, p := range u.Passwords {
+		parts = append(parts, "#"+p)
+	}
+	for _, k := range u.Keys {
+		parts = append(parts, "~"+k)
+	}
+	parts = append(parts, u.commands())
+	return strings.Join(parts, " ")
+}
+
+func inCategory(cmd, category string) bool {
+	spec, ok := commandByName[cmd]
+	if !ok {
+		return false
+	}
+	for _, c := range spec.categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func validCommandRule(rule string) bool {
+	if len(rule) < 2 || (rule[0] != '+' && rule[0] != '-') {
+		return false
+	}
+	name := rule[1:]
+	if name == "@all" {
+		return true
+	}
+	if name[0] == '@' {
+		for _, c := range aclCategories {
+			if c == name[1:] {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := commandByName[name]
+	return ok
+}
+
+// validPasswordHash reports whether hash is a sha256 hex digest, which
+// hashPassword writes in lowercase.
+func validPasswordHash(hash string) bool {
+	_, err := hex.DecodeString(hash)
+	return err == nil && len(hash) == 2*sha256.Size
+}
+
+func hashPassword(pass []byte) string {
+	sum := sha256.Sum256(pass)
+	return hex.EncodeToString(sum[:])
+}
+
+func addString(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, item := range list {
+		if item != s {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func aclHandle(cc *clientConn, args [][]byte) *Result {
+	acl := cc.server.acl
+	argc := len(args)
+	sub := strings.ToLower(utils.BytesToString(args[1]))
+	switch {
+	case sub == "setuser" && argc >= 3:
+		if err := acl.SetUser(string(args[2]), args[3:]); err != nil {
+			return &Result{status: errStatus, data: []byte(err.Error())}
+		}
+		return &Result{status: successStatus, data: []byte("OK")}
+	case sub == "getuser" && argc == 3:
+		user := acl.getUser(string(args[2]))
+		if user == nil {
+			return &Result{status: nilStatus}
+		}
+		return &Result{
+			status: arrayStatus,
+			array: []*Result{
+				{status: bulkStatus, data: []byte("flags")},
+				stringsResult(user.flags()),
+				{status: bulkStatus, data: []byte("passwords")},
+				stringsResult(user.Passwords),
+				{status: bulkStatus, data: []byte("commands")},
+				{status: bulkStatus, data: []byte(user.commands())},
+				{status: bulkStatus, data: []byte("keys")},
+				stringsResult(user.Keys),
+			},
+		}
+	case sub == "deluser" && argc >= 3:
+		cnt, err := acl.DelUser(args[2:])
+		if err != nil {
+			return &Result{status: errStatus, data: []byte(err.Error())}
+		}
+		return &Result{status: integerStatus, integer: cnt}
+	case (sub == "list" || sub == "users") && argc == 2:
+		acl.rwlock.RLock()
+		lines := acl.userNames()
+		if sub == "list" {
+			for i, name := range lines {
+				lines[i] = acl.users[name].describe()
+			}
+		}
+		acl.rwlock.RUnlock()
+		return stringsResult(lines)
+	case sub == "whoami" && argc == 2:
+		return &Result{status: bulkStatus, data: []byte(cc.user)}
+	case sub == "cat" && argc == 2:
+		return stringsResult(aclCategories)
+	case sub == "cat" && argc == 3:
+		category := strings.ToLower(utils.BytesToString(args[2]))
+		if !validCommandRule("+@" + category) {
+			return &Result{status: errStatus, data: []byte("ERR Unknown category '" + category + "'")}
+		}
+		var cmds []string
+		for _, spec := range commandSpecs {
+			if inCategory(spec.name, category) {
+				cmds = append(cmds, spec.name)
+			}
+		}
+		sort.Strings(cmds)
+		return stringsResult(cmds)
+	case sub == "load" && argc == 2:
+		if err := acl.Load(); err != nil {
+			return &Result{status: errStatus, data: []byte(err.Error())}
+		}
+		return &Result{status: successStatus, data: []byte("OK")}
+	case sub == "save" && argc == 2:
+		if err := acl.Save(); err != nil {
+			return &Result{status: errStatus, data: []byte(err.Error())}
+		}
+		return &Result{status: successStatus, data: []byte("OK")}
+	}
+	return &Result{
+		status: errStatus,
+		data:   []byte(fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%s'", bytes.ToUpper(args[1]))),
+	}
+}
+
+func stringsResult(list []string) *Result {
+	result := &Result{
+		status: arrayStatus,
+		array:  make([]*Result, 0, len(list)),
+	}
+	for _, s := range list {
+		result.array = append(result.array, &Result{status: bulkStatus, data: []byte(s)})
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestACLLoadPasswords(t *testing.T) {
+	hash := hashPassword([]byte("secret"))
+	tests := []struct {
+		hash string
+		isOk bool
+	}{
+		{hash, true},
+		{strings.ToUpper(hash), true},
+		{"", false},
+		{hash[:63], false},
+		{hash + "0", false},
+		{"secret", false},
+		{"g" + hash[1:], false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "users.json")
+		file := fmt.Sprintf(`{"Users": [{"Name": "app", "Enabled": true, "Passwords": [%q], "Commands": ["+@all"], "Keys": ["*"]}]}`, tt.hash)
+		if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		acl, err := NewACL("", path)
+		if (err == nil) != tt.isOk {
+			t.Errorf("NewACL with password hash %q: %v", tt.hash, err)
+			continue
+		}
+		if err == nil && !acl.Authenticate("app", []byte("secret")) {
+			t.Errorf("password hash %q does not authenticate", tt.hash)
+		}
+	}
+}
+
+func TestACLReconfigure(t *testing.T) {
+	acl, err := NewACL("old", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(t.TempDir(), "users.json")
+	if err := ioutil.WriteFile(broken, []byte(`{"Users": [{"Name": ""}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acl.Reconfigure("new", broken); err == nil {
+		t.Fatal("Reconfigure with a broken acl file succeeded")
+	}
+	if !acl.Authenticate(defaultUser, []byte("old")) {
+		t.Error("a failed Reconfigure changed requirepass")
+	}
+
+	apply, err := acl.Reconfigure("new", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acl.Authenticate(defaultUser, []byte("old")) {
+		t.Error("requirepass changed before apply")
+	}
+	apply()
+	if acl.Authenticate(defaultUser, []byte("old")) || !acl.Authenticate(defaultUser, []byte("new")) {
+		t.Error("requirepass not changed by apply")
+	}
+	// ACL LOAD keeps the new source
+	if err := acl.Load(); err != nil || !acl.Authenticate(defaultUser, []byte("new")) {
+		t.Errorf("Load after Reconfigure: %v", err)
+	}
+}
+
+func TestACLCanRun(t *testing.T) {
+	tests := []struct {
+		rules []string
+		cmd   string
+		isOk  bool
+	}{
+		{nil, "get", false},
+		{[]string{"+@all"}, "get", true},
+		{[]string{"+get"}, "get", true},
+		{[]string{"+get"}, "set", false},
+		// later rules win
+		{[]string{"+@all", "-get"}, "get", false},
+		{[]string{"+@all", "-get"}, "set", true},
+		{[]string{"-get", "+@all"}, "get", true},
+		{[]string{"+get", "-get"}, "get", false},
+		{[]string{"+@read"}, "get", true},
+		{[]string{"+@read"}, "set", false},
+		{[]string{"+@all", "-@write"}, "set", false},
+		{[]string{"+@all", "-@write"}, "hget", true},
+		{[]string{"+@all", "-@write", "+set"}, "set", true},
+		{[]string{"+@all", "-@write", "+set"}, "del", false},
+		{[]string{"+@string", "-@write"}, "get", true},
+		{[]string{"+@string", "-@write"}, "hget", false},
+		{[]string{"+@all", "-@all"}, "get", false},
+	}
+	for _, tt := range tests {
+		user := &aclUser{Commands: tt.rules}
+		if got := user.canRun(tt.cmd); got != tt.isOk {
+			t.Errorf("rules %v: canRun(%q) = %v, want %v", tt.rules, tt.cmd, got, tt.isOk)
+		}
+	}
+}
+
+func TestACLLoadCommandRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	file := `{"Users": [{"Name": "app", "Enabled": true, "NoPass": true, "Commands": ["+@READ", "+SET", "-HGET"], "Keys": ["*"]}]}`
+	if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	acl, err := NewACL("", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cmd, isOk := range map[string]bool{"get": true, "set": true, "hget": false, "del": false} {
+		if err := acl.Check("app", cmd, cmdArgs(cmd, "key")); (err == nil) != isOk {
+			t.Errorf("Check(%q) = %v, want allowed %v", cmd, err, isOk)
+		}
+	}
+}
+
+func TestACLKeyPatterns(t *testing.T) {
+	acl, err := NewACL("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := acl.SetUser("app", [][]byte{[]byte("on"), []byte("nopass"), []byte("+@all"), []byte("~app:*"), []byte("~shared")}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args [][]byte
+		isOk bool
+	}{
+		{cmdArgs("get", "app:1"), true},
+		{cmdArgs("get", "shared"), true},
+		{cmdArgs("get", "other"), false},
+		{cmdArgs("get", "shared:1"), false},
+		{cmdArgs("set", "app:1", "other"), true},
+		{cmdArgs("hget", "app:tb", "other"), true},
+		{cmdArgs("del", "app:1", "app:2", "shared"), true},
+		{cmdArgs("del", "app:1", "other", "app:2"), false},
+		{cmdArgs("del", "app:1", "app:2", "other"), false},
+		{cmdArgs("watch", "app:1", "other"), false},
+		{cmdArgs("watch", "app:1", "shared"), true},
+		// no keys to check
+		{cmdArgs("ping", "other"), true},
+	}
+	for _, tt := range tests {
+		err := acl.Check("app", string(tt.args[0]), tt.args)
+		if (err == nil) != tt.isOk {
+			t.Errorf("Check(%q) = %v, want allowed %v", tt.args, err, tt.isOk)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"../internal/utils"
+)
+
+var (
+	errSyntax     = errors.New("ERR syntax error")
+	errNotInteger = errors.New("ERR value is not an integer or out of range")
+	errNotFloat   = errors.New("ERR value is not a valid float")
+	errNotBound   = errors.New("ERR min or max is not a float")
+)
+
+type argKind int
+
+const (
+	argString argKind = iota
+	// signed 64 bit integer, written the strict way redis accepts
+	argInt
+	// float other than nan, inf and -inf included
+	argFloat
+	// sorted set score range end: a float, -inf or +inf, exclusive when
+	// prefixed with (
+	argScoreBound
+)
+
+// argOption is a keyword, matched case insensitively, followed by its
+// values. Options sharing a group exclude each other, an option given twice
+// keeps its last values.
+type argOption struct {
+	name   string
+	params []argKind
+	group  string
+}
+
+// argSchema describes the arguments following the command name: the fixed
+// ones, then either a group repeated up to the end or the options.
+type argSchema struct {
+	params  []argKind
+	repeat  []argKind
+	options []*argOption
+}
+
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+// Args holds the values of the arguments that passed their schema.
+type Args struct {
+	// parsed value of each argument, by position, nil for strings
+	values  []interface{}
+	options map[string]int
+}
+
+func (a *Args) Int(pos int) int64 {
+	return a.values[pos].(int64)
+}
+
+func (a *Args) Float(pos int) float64 {
+	return a.values[pos].(float64)
+}
+
+func (a *Args) Bound(pos int) scoreBound {
+	return a.values[pos].(scoreBound)
+}
+
+// Option returns the position of the option keyword, 0 when it was not
+// given. Its values follow it.
+func (a *Args) Option(name string) int {
+	return a.options[name]
+}
+
+func (a *Args) Has(name string) bool {
+	return a.options[name] > 0
+}
+
+// parse is the CheckFunc of the commands having a schema.
+func (schema *argSchema) parse(args [][]byte) (*Args, error) {
+	parsed := &Args{
+		values:  make([]interface{}, len(args)),
+		options: map[string]int{},
+	}
+	pos := 1
+	if pos+len(schema.params) > len(args) {
+		return nil, errSyntax
+	}
+	if err := parsed.parseValues(args, pos, schema.params); err != nil {
+		return nil, err
+	}
+	pos += len(schema.params)
+	if len(schema.repeat) > 0 {
+		if pos == len(args) || (len(args)-pos)%len(schema.repeat) != 0 {
+			return nil, errSyntax
+		}
+		for ; pos < len(args); pos += len(schema.repeat) {
+			if err := parsed.parseValues(args, pos, schema.repeat); err != nil {
+				return nil, err
+			}
+		}
+	}
+	groups := map[string]string{}
+	for pos < len(args) {
+		opt := schema.option(args[pos])
+		if opt == nil || pos+len(opt.params) >= len(args) {
+			return nil, errSyntax
+		}
+		if opt.group != "" {
+			if other, ok := groups[opt.group]; ok && other != opt.name {
+				return nil, errSyntax
+			}
+			groups[opt.group] = opt.name
+		}
+		if err := parsed.parseValues(args, pos+1, opt.params); err != nil {
+			return nil, err
+		}
+		parsed.options[opt.name] = pos
+		pos += 1 + len(opt.params)
+	}
+	return parsed, nil
+}
+
+func (schema *argSchema) option(arg []byte) *argOption {
+	name := strings.ToLower(utils.BytesToString(arg))
+	for _, opt := range schema.options {
+		if opt.name == name {
+			return opt
+		}
+	}
+	return nil
+}
+
+func (a *Args) parseValues(args [][]byte, pos int, kinds []argKind) error {
+	for i, kind := range kinds {
+		arg := args[pos+i]
+		switch kind {
+		case argInt:
+			val, ok := parseIntArg(arg)
+			if !ok {
+				return errNotInteger
+			}
+			a.values[pos+i] = val
+		case argFloat:
+			val, ok := parseFloatArg(arg)
+			if !ok {
+				return errNotFloat
+			}
+			a.values[pos+i] = val
+		case argScoreBound:
+			bound := scoreBound{}
+			if len(arg) > 0 && arg[0] == '(' {
+				bound.exclusive = true
+				arg = arg[1:]
+			}
+			val, ok := parseFloatArg(arg)
+			if !ok {
+				return errNotBound
+			}
+			bound.value = val
+			a.values[pos+i] = bound
+		}
+	}
+	return nil
+}
+
+// parseIntArg accepts what redis' string2ll does: no sign but -, no leading
+// zeros and no spaces.
+func parseIntArg(arg []byte) (int64, bool) {
+	s := utils.BytesToString(arg)
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || (digits[0] == '0' && s != "0") {
+		return 0, false
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, false
+		}
+	}
+	val, err := strconv.ParseInt(s, 10, 64)
+	return val, err == nil
+}
+
+func parseFloatArg(arg []byte) (float64, bool) {
+	val, err := strconv.ParseFloat(utils.BytesToString(arg), 64)
+	return val, err == nil && !math.IsNaN(val)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseIntArg(t *testing.T) {
+	tests := []struct {
+		arg  string
+		val  int64
+		isOk bool
+	}{
+		{"0", 0, true},
+		{"42", 42, true},
+		{"-42", -42, true},
+		{"9223372036854775807", math.MaxInt64, true},
+		{"-9223372036854775808", math.MinInt64, true},
+		{"-0", 0, false},
+		{"007", 0, false},
+		{"-07", 0, false},
+		{"00", 0, false},
+		{"+1", 0, false},
+		{" 1", 0, false},
+		{"1 ", 0, false},
+		{"", 0, false},
+		{"-", 0, false},
+		{"1.0", 0, false},
+		{"1e3", 0, false},
+		{"9223372036854775808", 0, false},
+		{"-9223372036854775809", 0, false},
+	}
+	for _, tt := range tests {
+		val, ok := parseIntArg([]byte(tt.arg))
+		if ok != tt.isOk || (ok && val != tt.val) {
+			t.Errorf("parseIntArg(%q) = %d, %v, want %d, %v", tt.arg, val, ok, tt.val, tt.isOk)
+		}
+	}
+}
+
+func TestParseFloatArg(t *testing.T) {
+	tests := []struct {
+		arg  string
+		val  float64
+		isOk bool
+	}{
+		{"0", 0, true},
+		{"-0", 0, true},
+		{"1.5", 1.5, true},
+		{"007", 7, true},
+		{"1e3", 1000, true},
+		{"inf", math.Inf(1), true},
+		{"+inf", math.Inf(1), true},
+		{"-inf", math.Inf(-1), true},
+		{"nan", 0, false},
+		{"NaN", 0, false},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"1.5x", 0, false},
+	}
+	for _, tt := range tests {
+		val, ok := parseFloatArg([]byte(tt.arg))
+		if ok != tt.isOk || (ok && val != tt.val) {
+			t.Errorf("parseFloatArg(%q) = %g, %v, want %g, %v", tt.arg, val, ok, tt.val, tt.isOk)
+		}
+	}
+}
+
+func splitArgs(line string) [][]byte {
+	var args [][]byte
+	for _, field := range strings.Fields(line) {
+		args = append(args, []byte(field))
+	}
+	return args
+}
+
+// The errors are the ones redis replies with for the same arguments.
+func TestArgSchemaParse(t *testing.T) {
+	tests := []struct {
+		line string
+		err  error
+	}{
+		{"set k v", nil},
+		{"set k v NX EX 10", nil},
+		{"set k v xx px 100", nil},
+		{"set k v nx nx", nil},
+		{"set k v ex 10 ex 20", nil},
+		{"set k v nx xx", errSyntax},
+		{"set k v ex 10 px 100", errSyntax},
+		{"set k v ex", errSyntax},
+		{"set k v ex ten", errNotInteger},
+		{"set k v ex 010", errNotInteger},
+		{"cas k 0 v", nil},
+		{"cas k -0 v", errNotInteger},
+		{"hincrby h f 1", nil},
+		{"hincrby h f 1.5", errNotInteger},
+		{"zadd z 1 a", nil},
+		{"zadd z 1 a 2 b", nil},
+		{"zadd z -inf a +inf b", nil},
+		{"zadd z 1 a 2", errSyntax},
+		{"zadd z 1", errSyntax},
+		{"zadd z one a", errNotFloat},
+		{"zadd z nan a", errNotFloat},
+		{"zrange z 0 -1", nil},
+		{"zrange z 0 -1 WITHSCORES", nil},
+		{"zrange z 0 -1 withscores limit", errSyntax},
+		{"zrange z 0 x", errNotInteger},
+		{"zrangebyscore z -inf +inf", nil},
+		{"zrangebyscore z (1 (2.5", nil},
+		{"zrangebyscore z (inf 1", nil},
+		{"zrangebyscore z ( 1", errNotBound},
+		{"zrangebyscore z [1 2", errNotBound},
+		{"zrangebyscore z nan 2", errNotBound},
+		{"zrangebyscore z 0 1 limit 0 10", nil},
+		{"zrangebyscore z 0 1 withscores limit 0 10", nil},
+		{"zrangebyscore z 0 1 limit 0", errSyntax},
+		{"zrangebyscore z 0 1 limit", errSyntax},
+		{"zrangebyscore z 0 1 limit 0 x", errNotInteger},
+		{"zincrby z 1.5 m", nil},
+		{"zincrby z inf m", nil},
+		{"zincrby z x m", errNotFloat},
+	}
+	for _, tt := range tests {
+		args := splitArgs(tt.line)
+		schema := argSchemas[strings.ToLower(string(args[0]))]
+		if _, err := schema.parse(args); err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.line, err, tt.err)
+		}
+	}
+}
+
+func TestArgSchemaValues(t *testing.T) {
+	parsed, err := argSchemas["zrangebyscore"].parse(splitArgs("zrangebyscore z (1 +inf WITHSCORES LIMIT 2 5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if min := parsed.Bound(2); min.value != 1 || !min.exclusive {
+		t.Errorf("min = %+v, want exclusive 1", min)
+	}
+	if max := parsed.Bound(3); !math.IsInf(max.value, 1) || max.exclusive {
+		t.Errorf("max = %+v, want inclusive +inf", max)
+	}
+	if !parsed.Has("withscores") {
+		t.Error("withscores not set")
+	}
+	pos := parsed.Option("limit")
+	if pos != 5 || parsed.Int(pos+1) != 2 || parsed.Int(pos+2) != 5 {
+		t.Errorf("limit at %d, want offset 2 and count 5 after position 5", pos)
+	}
+
+	// the last of repeated options wins
+	parsed, err = argSchemas["set"].parse(splitArgs("set k v ex 10 ex 20"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := parsed.Option("ex"); parsed.Int(pos+1) != 20 {
+		t.Errorf("ex = %d, want 20", parsed.Int(pos+1))
+	}
+}
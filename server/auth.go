@@ -0,0 +1,34 @@
+package server
+
+// authHandle serves both AUTH password, which logs in as the default user,
+// and AUTH username password.
+func authHandle(cc *clientConn, args [][]byte) *Result {
+	name, pass := defaultUser, args[1]
+	if len(args) == 3 {
+		name, pass = string(args[1]), args[2]
+	} else if cc.server.acl.DefaultLogin() == defaultUser {
+		return &Result{
+			status: errStatus,
+			data:   []byte("ERR Client sent AUTH, but no password is set"),
+		}
+	}
+	if !cc.server.acl.Authenticate(name, pass) {
+		return &Result{
+			status: errStatus,
+			data:   []byte("WRONGPASS invalid username-password pair or user is disabled."),
+		}
+	}
+	cc.user = name
+	return &Result{
+		status: successStatus,
+		data:   []byte("OK"),
+	}
+}
+
+func quitHandle(cc *clientConn, args [][]byte) *Result {
+	cc.quit = true
+	return &Result{
+		status: successStatus,
+		data:   []byte("OK"),
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookupAuthFirst(t *testing.T) {
+	s := newTestServer(1)
+	var err error
+	if s.acl, err = NewACL("secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user string
+		args []string
+		err  string
+	}{
+		{"", []string{"get", "key"}, "NOAUTH"},
+		{"", []string{"nosuchcommand"}, "NOAUTH"},
+		{"", []string{"get"}, "NOAUTH"},
+		{"", []string{"auth", "secret"}, ""},
+		{"", []string{"ping"}, ""},
+		{"", []string{"quit"}, ""},
+		{defaultUser, []string{"get", "key"}, ""},
+		{defaultUser, []string{"nosuchcommand"}, "ERR unknown command"},
+		{defaultUser, []string{"get"}, "ERR wrong number of arguments"},
+	}
+	for _, tt := range tests {
+		cc := &clientConn{server: s, user: tt.user}
+		_, err := cc.lookup(tt.args[0], cmdArgs(tt.args...))
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+			t.Errorf("user %q: lookup(%v) = %v, want %q", tt.user, tt.args, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"../internal/utils"
+)
+
+// countingConn counts the bytes moved over a client connection.
+type countingConn struct {
+	net.Conn
+	read    uint64
+	written uint64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.read, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.written, uint64(n))
+	return n, err
+}
+
+// clientInfo is what other connections may read about a client. The owning
+// connection refreshes it around every command.
+type clientInfo struct {
+	lock       sync.Mutex
+	created    time.Time
+	lastActive time.Time
+	name       string
+	user       string
+	cmd        string
+	sub        int
+	psub       int
+	multi      int
+	monitor    bool
+}
+
+func (cc *clientConn) updateInfo(cmd string) {
+	cc.info.lock.Lock()
+	defer cc.info.lock.Unlock()
+	if cmd != "" {
+		cc.info.cmd = cmd
+		cc.info.lastActive = time.Now()
+	}
+	cc.info.user = cc.user
+	cc.info.sub = len(cc.channels)
+	cc.info.psub = len(cc.patterns)
+	cc.info.multi = -1
+	if cc.multi {
+		cc.info.multi = len(cc.queued)
+	}
+}
+
+// describe renders the connection the way CLIENT LIST does.
+func (cc *clientConn) describe() string {
+	cc.info.lock.Lock()
+	defer cc.info.lock.Unlock()
+	now := time.Now()
+	flags := ""
+	if cc.info.sub+cc.info.psub > 0 {
+		flags += "P"
+	}
+	if cc.info.multi >= 0 {
+		flags += "x"
+	}
+	if cc.info.monitor {
+		flags += "O"
+	}
+	if cc.conn.LocalAddr().Network() == "unix" {
+		flags += "U"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s sub=%d psub=%d multi=%d tot-net-in=%d tot-net-out=%d cmd=%s user=%s",
+		cc.id, cc.conn.RemoteAddr(), cc.conn.LocalAddr(), cc.info.name,
+		int64(now.Sub(cc.info.created)/time.Second), int64(now.Sub(cc.info.lastActive)/time.Second),
+		flags, cc.info.sub, cc.info.psub, cc.info.multi,
+		atomic.LoadUint64(&cc.stat.read), atomic.LoadUint64(&cc.stat.written),
+		cc.info.cmd, cc.info.user)
+}
+
+func (cc *clientConn) getName() string {
+	cc.info.lock.Lock()
+	defer cc.info.lock.Unlock()
+	return cc.info.name
+}
+
+func (cc *clientConn) setName(name string) {
+	cc.info.lock.Lock()
+	cc.info.name = name
+	cc.info.lock.Unlock()
+}
+
+func (cc *clientConn) getUser() string {
+	cc.info.lock.Lock()
+	defer cc.info.lock.Unlock()
+	return cc.info.user
+}
+
+// Clients returns the connected clients ordered by id.
+func (s *Server) Clients() []*clientConn {
+	s.rwlock.RLock()
+	clients := make([]*clientConn, 0, len(s.clients))
+	for _, cc := range s.clients {
+		clients = append(clients, cc)
+	}
+	s.rwlock.RUnlock()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].id < clients[j].id
+	})
+	return clients
+}
+
+// kill closes the socket, the connection's own goroutine then notices and
+// cleans up. A client killing itself is closed after the reply is written.
+func (cc *clientConn) kill(self *clientConn) {
+	if cc == self {
+		cc.quit = true
+	} else {
+		cc.conn.Close()
+	}
+}
+
+func clientKill(cc *clientConn, args [][]byte) *Result {
+	// old form: CLIENT KILL addr
+	if len(args) == 3 {
+		for _, target := range cc.server.Clients() {
+			if target.conn.RemoteAddr().String() == string(args[2]) {
+				target.kill(cc)
+				return &Result{status: successStatus, data: []byte("OK")}
+			}
+		}
+		return &Result{status: errStatus, data: []byte("ERR No such client")}
+	}
+	if len(args)%2 != 0 {
+		return &Result{status: errStatus, data: []byte("ERR syntax error")}
+	}
+	var id uint64
+	var addr, laddr, user string
+	skipme := true
+	for i := 2; i < len(args); i += 2 {
+		val := utils.BytesToString(args[i+1])
+		switch strings.ToLower(utils.BytesToString(args[i])) {
+		case "id":
+			n, err := strconv.ParseUint(val, 10, 32)
+			if err != nil || n == 0 {
+				return &Result{status: errStatus, data: []byte("ERR client-id should be greater than 0")}
+			}
+			id = n
+		case "addr":
+			addr = val
+		case "laddr":
+			laddr = val
+		case "user":
+			user = val
+		case "skipme":
+			switch strings.ToLower(val) {
+			case "yes":
+				skipme = true
+			case "no":
+				skipme = false
+			default:
+				return &Result{status: errStatus, data: []byte("ERR syntax error")}
+			}
+		default:
+			return &Result{status: errStatus, data: []byte("ERR syntax error")}
+		}
+	}
+	var killed int
+	for _, target := range cc.server.Clients() {
+		if (id != 0 && uint64(target.id) != id) ||
+			(addr != "" && target.conn.RemoteAddr().String() != addr) ||
+			(laddr != "" && target.conn.LocalAddr().String() != laddr) ||
+			(user != "" && target.getUser() != user) ||
+			(skipme && target == cc) {
+			continue
+		}
+		target.kill(cc)
+		killed++
+	}
+	return &Result{status: integerStatus, integer: killed}
+}
+
+func clientHandle(cc *clientConn, args [][]byte) *Result {
+	argc := len(args)
+	sub := strings.ToLower(utils.BytesToString(args[1]))
+	switch {
+	case sub == "list" && argc == 2:
+		var buf bytes.Buffer
+		for _, client := range cc.server.Clients() {
+			buf.WriteString(client.describe())
+			buf.WriteByte('\n')
+		}
+		return &Result{status: bulkStatus, data: buf.Bytes()}
+	case sub == "info" && argc == 2:
+		return &Result{status: bulkStatus, data: []byte(cc.describe() + "\n")}
+	case sub == "id" && argc == 2:
+		return &Result{status: integerStatus, integer: int(cc.id)}
+	case sub == "getname" && argc == 2:
+		if name := cc.getName(); name != "" {
+			return &Result{status: bulkStatus, data: []byte(name)}
+		}
+		return &Result{status: nilStatus}
+	case sub == "setname" && argc == 3:
+		for _, c := range args[2] {
+			if c <= ' ' || c > '~' {
+				return &Result{
+					status: errStatus,
+					data:   []byte("ERR Client names cannot contain spaces, newlines or special characters."),
+				}
+			}
+		}
+		cc.setName(string(args[2]))
+		return &Result{status: successStatus, data: []byte("OK")}
+	case sub == "kill" && argc >= 3:
+		return clientKill(cc, args)
+	}
+	return &Result{
+		status: errStatus,
+		data:   []byte("ERR Unknown subcommand or wrong number of arguments for '" + string(bytes.ToUpper(args[1])) + "'"),
+	}
+}
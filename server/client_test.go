@@ -0,0 +1,180 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// peerConn is a client connection with its own addresses.
+type peerConn struct {
+	bufConn
+	remote, local net.Addr
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *peerConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// newClients registers four clients: ids 1 to 4 from 10.0.0.<id>:500<id>,
+// the odd ones on 127.0.0.1:6379 and the even ones on 127.0.0.1:6380, the
+// first two logged in as default and the others as app.
+func newClients() ([]*clientConn, []*peerConn) {
+	s := newTestServer(8)
+	s.clients = map[uint32]*clientConn{}
+	var clients []*clientConn
+	var conns []*peerConn
+	for id := 1; id <= 4; id++ {
+		conn := &peerConn{
+			remote: &net.TCPAddr{IP: net.IPv4(10, 0, 0, byte(id)), Port: 5000 + id},
+			local:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6378 + 2 - id%2},
+		}
+		stat := &countingConn{Conn: conn}
+		cc := &clientConn{id: uint32(id), server: s, conn: stat, stat: stat, wr: NewWriter(stat), user: "app"}
+		if id <= 2 {
+			cc.user = defaultUser
+		}
+		cc.info.created, cc.info.lastActive = time.Now(), time.Now()
+		cc.updateInfo("")
+		s.clients[cc.id] = cc
+		clients = append(clients, cc)
+		conns = append(conns, conn)
+	}
+	return clients, conns
+}
+
+func TestClientKill(t *testing.T) {
+	tests := []struct {
+		args []string
+		// killed ids, client 1 runs the command
+		killed []int
+	}{
+		{[]string{"ID", "2"}, []int{2}},
+		{[]string{"ID", "99"}, nil},
+		{[]string{"ID", "1"}, nil},
+		{[]string{"ID", "1", "SKIPME", "no"}, []int{1}},
+		{[]string{"ADDR", "10.0.0.3:5003"}, []int{3}},
+		{[]string{"ADDR", "10.0.0.3:5004"}, nil},
+		{[]string{"LADDR", "127.0.0.1:6380"}, []int{2, 4}},
+		{[]string{"LADDR", "127.0.0.1:6379"}, []int{3}},
+		{[]string{"LADDR", "127.0.0.1:6379", "SKIPME", "NO"}, []int{1, 3}},
+		{[]string{"USER", "app"}, []int{3, 4}},
+		{[]string{"USER", "default"}, []int{2}},
+		{[]string{"USER", "default", "SKIPME", "yes"}, []int{2}},
+		{[]string{"USER", "default", "SKIPME", "no"}, []int{1, 2}},
+		{[]string{"USER", "app", "LADDR", "127.0.0.1:6380"}, []int{4}},
+		{[]string{"USER", "app", "ID", "2"}, nil},
+		{[]string{"SKIPME", "no"}, []int{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		clients, conns := newClients()
+		res := clientHandle(clients[0], cmdArgs(append([]string{"client", "kill"}, tt.args...)...))
+		if res.status != integerStatus || res.integer != len(tt.killed) {
+			t.Errorf("CLIENT KILL %v = %d %q, want %d", tt.args, res.integer, res.data, len(tt.killed))
+		}
+		var killed []int
+		for i, cc := range clients {
+			// the caller itself goes once the reply is written
+			if conns[i].isClosed() || cc.quit {
+				killed = append(killed, int(cc.id))
+			}
+		}
+		if fmt.Sprint(killed) != fmt.Sprint(tt.killed) {
+			t.Errorf("CLIENT KILL %v killed %v, want %v", tt.args, killed, tt.killed)
+		}
+	}
+}
+
+func TestClientKillErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"ID", "0"}, "ERR client-id should be greater than 0"},
+		{[]string{"ID", "x"}, "ERR client-id should be greater than 0"},
+		{[]string{"ID", "2", "USER"}, "ERR syntax error"},
+		{[]string{"SKIPME", "maybe"}, "ERR syntax error"},
+		{[]string{"NAME", "x"}, "ERR syntax error"},
+		// the old form takes an address only
+		{[]string{"10.0.0.9:5009"}, "ERR No such client"},
+	}
+	for _, tt := range tests {
+		clients, conns := newClients()
+		res := clientHandle(clients[0], cmdArgs(append([]string{"client", "kill"}, tt.args...)...))
+		if res.status != errStatus || string(res.data) != tt.err {
+			t.Errorf("CLIENT KILL %v = %q, want %q", tt.args, res.data, tt.err)
+		}
+		for i := range conns {
+			if conns[i].isClosed() {
+				t.Errorf("CLIENT KILL %v closed client %d", tt.args, i+1)
+			}
+		}
+	}
+
+	clients, conns := newClients()
+	res := clientHandle(clients[0], cmdArgs("client", "kill", "10.0.0.2:5002"))
+	if res.status != successStatus || !conns[1].isClosed() || conns[2].isClosed() {
+		t.Errorf("CLIENT KILL 10.0.0.2:5002 = %q, closed %v %v", res.data, conns[1].isClosed(), conns[2].isClosed())
+	}
+}
+
+func TestClientSetName(t *testing.T) {
+	tests := []struct {
+		name string
+		isOk bool
+	}{
+		{"worker-1", true},
+		{"", true},
+		{"two words", false},
+		{" lead", false},
+		{"tab\there", false},
+		{"line\nbreak", false},
+		{"nul\x00", false},
+		{"caf\xc3\xa9", false},
+	}
+	for _, tt := range tests {
+		clients, _ := newClients()
+		cc := clients[0]
+		cc.setName("old")
+		res := clientHandle(cc, cmdArgs("client", "setname", tt.name))
+		if (res.status == successStatus) != tt.isOk {
+			t.Errorf("CLIENT SETNAME %q = %q", tt.name, res.data)
+		}
+		want := "old"
+		if tt.isOk {
+			want = tt.name
+		}
+		if got := cc.getName(); got != want {
+			t.Errorf("name after CLIENT SETNAME %q = %q, want %q", tt.name, got, want)
+		}
+	}
+}
+
+func TestClientList(t *testing.T) {
+	clients, _ := newClients()
+	clientHandle(clients[1], cmdArgs("client", "setname", "worker"))
+	clients[1].updateInfo("client")
+	clients[2].multi = true
+	clients[2].updateInfo("multi")
+
+	res := clientHandle(clients[0], cmdArgs("client", "list"))
+	if res.status != bulkStatus {
+		t.Fatalf("CLIENT LIST = %v %q", res.status, res.data)
+	}
+	want := []string{
+		"id=1 addr=10.0.0.1:5001 laddr=127.0.0.1:6379 name= age=0 idle=0 flags=N sub=0 psub=0 multi=-1 tot-net-in=0 tot-net-out=0 cmd= user=default",
+		"id=2 addr=10.0.0.2:5002 laddr=127.0.0.1:6380 name=worker age=0 idle=0 flags=N sub=0 psub=0 multi=-1 tot-net-in=0 tot-net-out=0 cmd=client user=default",
+		"id=3 addr=10.0.0.3:5003 laddr=127.0.0.1:6379 name= age=0 idle=0 flags=x sub=0 psub=0 multi=0 tot-net-in=0 tot-net-out=0 cmd=multi user=app",
+		"id=4 addr=10.0.0.4:5004 laddr=127.0.0.1:6380 name= age=0 idle=0 flags=N sub=0 psub=0 multi=-1 tot-net-in=0 tot-net-out=0 cmd= user=app",
+		"",
+	}
+	if got := string(res.data); got != strings.Join(want, "\n") {
+		t.Errorf("CLIENT LIST =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
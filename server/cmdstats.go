@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"../internal/utils"
+)
+
+const (
+	// the histogram has histSubBuckets linear buckets per power of two,
+	// keeping percentiles within about 6% of the real latency
+	histSubBits    = 4
+	histSubBuckets = 1 << histSubBits
+	// latencies from 1us to 2^37us, about 38 hours, longer ones land in the
+	// last bucket
+	histMaxShift = 32
+	histBuckets  = histSubBuckets * (histMaxShift + 2)
+)
+
+var (
+	// percentiles INFO latencystats reports, like redis' default
+	latencyPercentiles = []float64{50, 99, 99.9}
+)
+
+// latencyHistogram counts latencies in microseconds.
+type latencyHistogram struct {
+	counts [histBuckets]uint64
+}
+
+func histBucket(usec uint64) int {
+	if usec < histSubBuckets {
+		return int(usec)
+	}
+	shift := bits.Len64(usec) - histSubBits - 1
+	if shift > histMaxShift {
+		return histBuckets - 1
+	}
+	return histSubBuckets*(shift+1) + int(usec>>uint(shift)) - histSubBuckets
+}
+
+// histUpperBound is the highest latency counted in the bucket.
+func histUpperBound(idx int) uint64 {
+	if idx < histSubBuckets {
+		return uint64(idx)
+	}
+	shift := uint(idx/histSubBuckets - 1)
+	sub := uint64(idx%histSubBuckets + histSubBuckets)
+	return (sub+1)<<shift - 1
+}
+
+func (h *latencyHistogram) record(usec uint64) {
+	atomic.AddUint64(&h.counts[histBucket(usec)], 1)
+}
+
+func (h *latencyHistogram) snapshot() []uint64 {
+	counts := make([]uint64, histBuckets)
+	for i := range h.counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return counts
+}
+
+func (h *latencyHistogram) reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+}
+
+// percentile returns the upper bound of the bucket holding the percentile.
+func percentile(counts []uint64, total uint64, p float64) uint64 {
+	rank := uint64(float64(total)*p/100 + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for idx, n := range counts {
+		seen += n
+		if seen >= rank {
+			return histUpperBound(idx)
+		}
+	}
+	return 0
+}
+
+// commandStats are the counters of one command, updated atomically.
+type commandStats struct {
+	calls uint64
+	usec  uint64
+	// refused before running: unknown to the user's ACL, wrong number of
+	// arguments, not authenticated or not allowed in the connection's mode
+	rejectedCalls uint64
+	// ran and replied with an error
+	failedCalls uint64
+	latency     latencyHistogram
+}
+
+func newCommandStats() map[string]*commandStats {
+	stats := make(map[string]*commandStats, len(commandSpecs))
+	for _, spec := range commandSpecs {
+		stats[spec.name] = &commandStats{}
+	}
+	return stats
+}
+
+// recordCall accounts a command that ran, res being its reply.
+func (s *Server) recordCall(name string, elapsed time.Duration, res *Result) {
+	stats, ok := s.cmdStats[name]
+	if !ok {
+		return
+	}
+	usec := uint64(elapsed / time.Microsecond)
+	atomic.AddUint64(&stats.calls, 1)
+	atomic.AddUint64(&stats.usec, usec)
+	if res != nil && res.status&errStatus != 0 {
+		atomic.AddUint64(&stats.failedCalls, 1)
+	}
+	stats.latency.record(usec)
+}
+
+func (s *Server) recordRejected(name string) {
+	if stats, ok := s.cmdStats[name]; ok {
+		atomic.AddUint64(&stats.rejectedCalls, 1)
+	}
+}
+
+// ResetStats clears the counters INFO reports, like CONFIG RESETSTAT.
+func (s *Server) ResetStats() {
+	for _, stats := range s.cmdStats {
+		atomic.StoreUint64(&stats.calls, 0)
+		atomic.StoreUint64(&stats.usec, 0)
+		atomic.StoreUint64(&stats.rejectedCalls, 0)
+		atomic.StoreUint64(&stats.failedCalls, 0)
+		stats.latency.reset()
+	}
+	atomic.StoreUint64(&s.stats.commands, 0)
+	atomic.StoreUint64(&s.stats.connections, 0)
+	atomic.StoreUint64(&s.stats.rejectedConnections, 0)
+	atomic.StoreUint64(&s.stats.protocolErrors, 0)
+	atomic.StoreUint64(&s.stats.outputLimitDisconnections, 0)
+	atomic.StoreUint64(&s.stats.tokenWaitUsec, 0)
+	s.stats.tokenWait.reset()
+	s.rwlock.Lock()
+	s.stats.opsSamples = [opsSamples]uint64{}
+	s.rwlock.Unlock()
+}
+
+func (s *Server) commandStatsInfo(line func(format string, args ...interface{})) {
+	for _, spec := range commandSpecs {
+		stats := s.cmdStats[spec.name]
+		calls := atomic.LoadUint64(&stats.calls)
+		rejected := atomic.LoadUint64(&stats.rejectedCalls)
+		if calls == 0 && rejected == 0 {
+			continue
+		}
+		usec := atomic.LoadUint64(&stats.usec)
+		var perCall float64
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+		line("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+			spec.name, calls, usec, perCall, rejected, atomic.LoadUint64(&stats.failedCalls))
+	}
+}
+
+func (s *Server) latencyStatsInfo(line func(format string, args ...interface{})) {
+	for _, spec := range commandSpecs {
+		counts := s.cmdStats[spec.name].latency.snapshot()
+		var total uint64
+		for _, n := range counts {
+			total += n
+		}
+		if total == 0 {
+			continue
+		}
+		parts := make([]string, 0, len(latencyPercentiles))
+		for _, p := range latencyPercentiles {
+			parts = append(parts, fmt.Sprintf("p%g=%.3f", p, float64(percentile(counts, total, p))))
+		}
+		line("latency_percentiles_usec_%s:%s", spec.name, strings.Join(parts, ","))
+	}
+}
+
+// histogramReply renders the latencies of a command the way LATENCY
+// HISTOGRAM does: the calls, then the cumulative count of calls up to each
+// power of two microseconds, skipping the powers adding no call.
+func (stats *commandStats) histogramReply() *Result {
+	counts := stats.latency.snapshot()
+	buckets := &Result{status: arrayStatus}
+	var total, reported uint64
+	bound := uint64(1)
+	for idx, n := range counts {
+		for histUpperBound(idx) > bound {
+			if total > reported {
+				buckets.array = append(buckets.array,
+					&Result{status: integerStatus, integer: int(bound)},
+					&Result{status: integerStatus, integer: int(total)})
+				reported = total
+			}
+			bound <<= 1
+		}
+		total += n
+	}
+	if total > reported {
+		buckets.array = append(buckets.array,
+			&Result{status: integerStatus, integer: int(bound)},
+			&Result{status: integerStatus, integer: int(total)})
+	}
+	return &Result{
+		status: arrayStatus,
+		array: []*Result{
+			{status: bulkStatus, data: []byte("calls")},
+			{status: integerStatus, integer: int(atomic.LoadUint64(&stats.calls))},
+			{status: bulkStatus, data: []byte("histogram_usec")},
+			buckets,
+		},
+	}
+}
+
+func latencyHandle(cc *clientConn, args [][]byte) *Result {
+	sub := strings.ToLower(utils.BytesToString(args[1]))
+	if sub != "histogram" {
+		return &Result{
+			status: errStatus,
+			data:   []byte("ERR Unknown subcommand or wrong number of arguments for '" + string(bytes.ToUpper(args[1])) + "'"),
+		}
+	}
+	var names []string
+	if len(args) == 2 {
+		for _, spec := range commandSpecs {
+			if atomic.LoadUint64(&cc.server.cmdStats[spec.name].calls) > 0 {
+				names = append(names, spec.name)
+			}
+		}
+	} else {
+		for _, arg := range args[2:] {
+			name := strings.ToLower(utils.BytesToString(arg))
+			if _, ok := cc.server.cmdStats[name]; ok {
+				names = append(names, name)
+			}
+		}
+	}
+	result := &Result{
+		status: arrayStatus,
+		array:  make([]*Result, 0, 2*len(names)),
+	}
+	for _, name := range names {
+		result.array = append(result.array,
+			&Result{status: bulkStatus, data: []byte(name)},
+			cc.server.cmdStats[name].histogramReply())
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHistBucketBoundaries(t *testing.T) {
+	// below histSubBuckets every microsecond has its bucket
+	for usec := uint64(0); usec < histSubBuckets; usec++ {
+		if idx := histBucket(usec); idx != int(usec) || histUpperBound(idx) != usec {
+			t.Errorf("histBucket(%d) = %d, upper bound %d", usec, idx, histUpperBound(idx))
+		}
+	}
+	// every bucket holds what lies between the previous upper bound and its own
+	for idx := 0; idx < histBuckets-1; idx++ {
+		upper := histUpperBound(idx)
+		if got := histBucket(upper); got != idx {
+			t.Errorf("histBucket(%d) = %d, want %d", upper, got, idx)
+		}
+		if got := histBucket(upper + 1); got != idx+1 {
+			t.Errorf("histBucket(%d) = %d, want %d", upper+1, got, idx+1)
+		}
+	}
+	tests := []struct {
+		usec  uint64
+		idx   int
+		upper uint64
+	}{
+		{16, 16, 16},
+		{17, 17, 17},
+		{31, 31, 31},
+		{32, 32, 33},
+		{33, 32, 33},
+		{100, 57, 103},
+		{1000, 111, 1023},
+		{1 << 37, histBuckets - 1, 1<<37 - 1},
+		{math.MaxUint64, histBuckets - 1, 1<<37 - 1},
+	}
+	for _, tt := range tests {
+		idx := histBucket(tt.usec)
+		if idx != tt.idx || histUpperBound(idx) != tt.upper {
+			t.Errorf("histBucket(%d) = %d with upper bound %d, want %d and %d",
+				tt.usec, idx, histUpperBound(idx), tt.idx, tt.upper)
+		}
+	}
+	// the buckets stay within 1/histSubBuckets of the latency
+	for _, usec := range []uint64{100, 12345, 987654, 1 << 30} {
+		upper := histUpperBound(histBucket(usec))
+		if upper < usec || float64(upper-usec) > float64(usec)/histSubBuckets {
+			t.Errorf("upper bound %d too far from %d", upper, usec)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var h latencyHistogram
+	for usec := uint64(1); usec <= 100; usec++ {
+		h.record(usec)
+	}
+	counts := h.snapshot()
+	tests := []struct {
+		p    float64
+		want uint64
+	}{
+		{0, 1},
+		{50, 51},
+		{99, 99},
+		{99.9, 103},
+		{100, 103},
+	}
+	for _, tt := range tests {
+		if got := percentile(counts, 100, tt.p); got != tt.want {
+			t.Errorf("p%g = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(make([]uint64, histBuckets), 0, 50); got != 0 {
+		t.Errorf("percentile of no call = %d, want 0", got)
+	}
+}
+
+// histogramBuckets returns the cumulative counts of a LATENCY HISTOGRAM entry.
+func histogramBuckets(res *Result) []int {
+	var buckets []int
+	for _, r := range res.array[3].array {
+		buckets = append(buckets, r.integer)
+	}
+	return buckets
+}
+
+func TestHistogramReply(t *testing.T) {
+	stats := &commandStats{}
+	for _, usec := range []uint64{1, 3, 5, 100} {
+		stats.calls++
+		stats.latency.record(usec)
+	}
+	res := stats.histogramReply()
+	if calls := res.array[1].integer; calls != 4 {
+		t.Errorf("calls = %d, want 4", calls)
+	}
+	// bounds with the number of calls up to them, powers of two adding no
+	// call are left out
+	want := []int{1, 1, 4, 2, 8, 3, 128, 4}
+	if got := histogramBuckets(res); !reflect.DeepEqual(got, want) {
+		t.Errorf("histogram = %v, want %v", got, want)
+	}
+
+	if got := histogramBuckets((&commandStats{}).histogramReply()); len(got) != 0 {
+		t.Errorf("histogram without calls = %v, want none", got)
+	}
+
+	stats.latency.reset()
+	stats.latency.record(0)
+	stats.latency.record(1 << 40)
+	want = []int{1, 1, 1 << 37, 2}
+	if got := histogramBuckets(stats.histogramReply()); !reflect.DeepEqual(got, want) {
+		t.Errorf("histogram = %v, want %v", got, want)
+	}
+}
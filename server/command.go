@@ -0,0 +1,180 @@
+package server
+
+//go:generate go run gencommands.go
+
+import (
+	"bytes"
+	"strings"
+
+	"../internal/utils"
+)
+
+// commandSpec describes a command the way COMMAND reports it. The specs are
+// generated from doc/commands.json, which the docs are generated from too.
+type commandSpec struct {
+	name string
+	// like redis, -N means at least N arguments including the command
+	arity int
+	// upper bound for a variadic command, 0 means none
+	maxArgs    int
+	flags      []string
+	firstKey   int
+	lastKey    int
+	step       int
+	categories []string
+}
+
+func (spec *commandSpec) hasFlag(flag string) bool {
+	for _, f := range spec.flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func (spec *commandSpec) argRange() (int, int) {
+	if spec.arity > 0 {
+		return spec.arity, spec.arity
+	}
+	return -spec.arity, spec.maxArgs
+}
+
+// commandByName indexes commandSpecs.
+var commandByName = map[string]*commandSpec{}
+
+// init builds CmdMap from the spec and the implementations bound to it.
+func init() {
+	for _, spec := range commandSpecs {
+		commandByName[spec.name] = spec
+		minParams, maxParams := spec.argRange()
+		var check CheckFunc
+		if schema, ok := argSchemas[spec.name]; ok {
+			check = schema.parse
+		}
+		var handler *CmdHandler
+		if handle, ok := connHandleFuncs[spec.name]; ok {
+			handler = NewConnCmdHandler(spec.name, minParams, maxParams, check, handle)
+		} else if handle, ok := handleFuncs[spec.name]; ok {
+			handler = NewCmdHandler(spec.name, minParams, maxParams, check, handle)
+		} else {
+			// a command advertised without an implementation would crash the
+			// connection running it
+			panic("command " + spec.name + " has no implementation")
+		}
+		handler.spec = spec
+		CmdMap[spec.name] = handler
+	}
+}
+
+// commandKeys returns the arguments of cmd that are keys.
+func commandKeys(cmd string, args [][]byte) [][]byte {
+	spec, ok := commandByName[cmd]
+	if !ok || spec.firstKey == 0 || spec.firstKey >= len(args) {
+		return nil
+	}
+	last := spec.lastKey
+	if last < 0 {
+		last += len(args)
+	}
+	if last >= len(args) {
+		last = len(args) - 1
+	}
+	if spec.step == 1 {
+		return args[spec.firstKey : last+1]
+	}
+	var keys [][]byte
+	for i := spec.firstKey; i <= last; i += spec.step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+func statusList(list []string, prefix string) *Result {
+	result := &Result{
+		status: arrayStatus,
+		array:  make([]*Result, 0, len(list)),
+	}
+	for _, s := range list {
+		result.array = append(result.array, &Result{status: successStatus, data: []byte(prefix + s)})
+	}
+	return result
+}
+
+// reply renders the spec as a COMMAND entry: name, arity, flags, first key,
+// last key, step and acl categories.
+func (spec *commandSpec) reply() *Result {
+	return &Result{
+		status: arrayStatus,
+		array: []*Result{
+			{status: bulkStatus, data: []byte(spec.name)},
+			{status: integerStatus, integer: spec.arity},
+			statusList(spec.flags, ""),
+			{status: integerStatus, integer: spec.firstKey},
+			{status: integerStatus, integer: spec.lastKey},
+			{status: integerStatus, integer: spec.step},
+			statusList(spec.categories, "@"),
+		},
+	}
+}
+
+func commandHandle(cc *clientConn, args [][]byte) *Result {
+	argc := len(args)
+	if argc == 1 {
+		result := &Result{
+			status: arrayStatus,
+			array:  make([]*Result, 0, len(commandSpecs)),
+		}
+		for _, spec := range commandSpecs {
+			result.array = append(result.array, spec.reply())
+		}
+		return result
+	}
+	sub := strings.ToLower(utils.BytesToString(args[1]))
+	switch {
+	case sub == "count" && argc == 2:
+		return &Result{status: integerStatus, integer: len(commandSpecs)}
+	case sub == "info":
+		result := &Result{
+			status: arrayStatus,
+			array:  make([]*Result, 0, argc-2),
+		}
+		for _, name := range args[2:] {
+			if spec, ok := commandByName[strings.ToLower(utils.BytesToString(name))]; ok {
+				result.array = append(result.array, spec.reply())
+			} else {
+				result.array = append(result.array, nil)
+			}
+		}
+		return result
+	case sub == "getkeys" && argc >= 3:
+		return commandGetKeys(args[2:])
+	}
+	return &Result{
+		status: errStatus,
+		data:   []byte("ERR Unknown subcommand or wrong number of arguments for '" + string(bytes.ToUpper(args[1])) + "'"),
+	}
+}
+
+func commandGetKeys(args [][]byte) *Result {
+	name := strings.ToLower(utils.BytesToString(args[0]))
+	handler, ok := CmdMap[name]
+	if !ok {
+		return &Result{status: errStatus, data: []byte("ERR Invalid command specified")}
+	}
+	if handler.check(args) != nil {
+		return &Result{status: errStatus, data: []byte("ERR Invalid number of arguments specified for command")}
+	}
+	keys := commandKeys(name, args)
+	if len(keys) == 0 {
+		return &Result{status: errStatus, data: []byte("ERR The command has no key arguments")}
+	}
+	result := &Result{
+		status: arrayStatus,
+		array:  make([]*Result, 0, len(keys)),
+	}
+	for _, key := range keys {
+		result.array = append(result.array, &Result{status: bulkStatus, data: key})
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+// Code generated by gencommands.go from doc/commands.json. DO NOT EDIT.
+
+package server
+
+var commandSpecs = []*commandSpec{
+	{name: "set", arity: -3, maxArgs: 0, flags: []string{"write", "denyoom"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "string"}},
+	{name: "get", arity: 2, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "string"}},
+	{name: "exists", arity: 2, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "string"}},
+	{name: "del", arity: -2, maxArgs: 0, flags: []string{"write"}, firstKey: 1, lastKey: -1, step: 1, categories: []string{"write", "string"}},
+	{name: "strlen", arity: 2, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "string"}},
+	{name: "getver", arity: 2, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "string"}},
+	{name: "cas", arity: 4, maxArgs: 0, flags: []string{"write", "denyoom"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "string"}},
+	{name: "cad", arity: 3, maxArgs: 0, flags: []string{"write"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "string"}},
+	{name: "hdel", arity: -3, maxArgs: 0, flags: []string{"write", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "hash"}},
+	{name: "hexists", arity: 3, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "hash"}},
+	{name: "hget", arity: 3, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "hash"}},
+	{name: "hincrby", arity: 4, maxArgs: 0, flags: []string{"write", "denyoom", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "hash"}},
+	{name: "hset", arity: 4, maxArgs: 0, flags: []string{"write", "denyoom", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "hash"}},
+	{name: "hlen", arity: 2, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "hash"}},
+	{name: "sadd", arity: -3, maxArgs: 0, flags: []string{"write", "denyoom", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "set"}},
+	{name: "sismember", arity: 3, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "set"}},
+	{name: "srem", arity: -3, maxArgs: 0, flags: []string{"write", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "set"}},
+	{name: "scard", arity: 2, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "set"}},
+	{name: "zadd", arity: -4, maxArgs: 0, flags: []string{"write", "denyoom", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "zset"}},
+	{name: "zrange", arity: -4, maxArgs: 5, flags: []string{"readonly"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "zset"}},
+	{name: "zrangebyscore", arity: -4, maxArgs: 0, flags: []string{"readonly"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "zset"}},
+	{name: "zrem", arity: -3, maxArgs: 0, flags: []string{"write", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "zset"}},
+	{name: "zscore", arity: 3, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "zset"}},
+	{name: "zincrby", arity: 4, maxArgs: 0, flags: []string{"write", "denyoom", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"write", "zset"}},
+	{name: "zcard", arity: 2, maxArgs: 0, flags: []string{"readonly", "fast"}, firstKey: 1, lastKey: 1, step: 1, categories: []string{"read", "zset"}},
+	{name: "echo", arity: 2, maxArgs: 0, flags: []string{"fast"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"connection"}},
+	{name: "ping", arity: -1, maxArgs: 2, flags: []string{"stale", "fast", "no_auth"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"connection"}},
+	{name: "auth", arity: -2, maxArgs: 3, flags: []string{"noscript", "loading", "stale", "fast", "no_auth"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"connection"}},
+	{name: "acl", arity: -2, maxArgs: 0, flags: []string{"admin", "noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"admin"}},
+	{name: "watch", arity: -2, maxArgs: 0, flags: []string{"noscript", "loading", "stale", "fast"}, firstKey: 1, lastKey: -1, step: 1, categories: []string{"transaction"}},
+	{name: "unwatch", arity: 1, maxArgs: 0, flags: []string{"noscript", "loading", "stale", "fast"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"transaction"}},
+	{name: "multi", arity: 1, maxArgs: 0, flags: []string{"noscript", "loading", "stale", "fast"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"transaction"}},
+	{name: "exec", arity: 1, maxArgs: 0, flags: []string{"noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"transaction"}},
+	{name: "discard", arity: 1, maxArgs: 0, flags: []string{"noscript", "loading", "stale", "fast"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"transaction"}},
+	{name: "subscribe", arity: -2, maxArgs: 0, flags: []string{"pubsub", "noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"pubsub"}},
+	{name: "unsubscribe", arity: -1, maxArgs: 0, flags: []string{"pubsub", "noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"pubsub"}},
+	{name: "psubscribe", arity: -2, maxArgs: 0, flags: []string{"pubsub", "noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"pubsub"}},
+	{name: "punsubscribe", arity: -1, maxArgs: 0, flags: []string{"pubsub", "noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"pubsub"}},
+	{name: "publish", arity: 3, maxArgs: 0, flags: []string{"pubsub", "loading", "stale", "fast"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"pubsub"}},
+	{name: "pubsub", arity: -2, maxArgs: 0, flags: []string{"pubsub", "random", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"pubsub"}},
+	{name: "client", arity: -2, maxArgs: 0, flags: []string{"admin", "noscript", "random", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"admin", "connection"}},
+	{name: "info", arity: -1, maxArgs: 2, flags: []string{"random", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"admin"}},
+	{name: "command", arity: -1, maxArgs: 0, flags: []string{"random", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"connection"}},
+	{name: "config", arity: -2, maxArgs: 0, flags: []string{"admin", "noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"admin"}},
+	{name: "shutdown", arity: -1, maxArgs: 2, flags: []string{"admin", "noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"admin"}},
+	{name: "slowlog", arity: -2, maxArgs: 0, flags: []string{"admin", "random", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"admin"}},
+	{name: "latency", arity: -2, maxArgs: 0, flags: []string{"admin", "noscript", "loading", "stale"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"admin"}},
+	{name: "monitor", arity: 1, maxArgs: 0, flags: []string{"admin", "noscript", "loading", "stale", "no_multi"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"admin"}},
+	{name: "quit", arity: 1, maxArgs: 0, flags: []string{"loading", "stale", "fast", "no_auth"}, firstKey: 0, lastKey: 0, step: 0, categories: []string{"connection"}},
+}
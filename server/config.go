@@ -0,0 +1,51 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"../internal/utils"
+
+	"github.com/cihub/seelog"
+)
+
+// SetReloader installs what CONFIG RELOAD and Reload run, the owner of the
+// server knows where the configuration lives.
+func (s *Server) SetReloader(reloader func() error) {
+	s.reloadLock.Lock()
+	s.reloader = reloader
+	s.reloadLock.Unlock()
+}
+
+// Reload runs the reloader, one reload at a time.
+func (s *Server) Reload() error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	if s.reloader == nil {
+		return errors.New("reload is not supported")
+	}
+	if err := s.reloader(); err != nil {
+		seelog.Errorf("reload failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+func configHandle(cc *clientConn, args [][]byte) *Result {
+	sub := strings.ToLower(utils.BytesToString(args[1]))
+	switch {
+	case sub == "reload" && len(args) == 2:
+		if err := cc.server.Reload(); err != nil {
+			return &Result{status: errStatus, data: []byte("ERR " + err.Error())}
+		}
+		return &Result{status: successStatus, data: []byte("OK")}
+	case sub == "resetstat" && len(args) == 2:
+		cc.server.ResetStats()
+		return &Result{status: successStatus, data: []byte("OK")}
+	}
+	return &Result{
+		status: errStatus,
+		data:   []byte("ERR Unknown subcommand or wrong number of arguments for '" + string(bytes.ToUpper(args[1])) + "'"),
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"../hustdb/comm"
 	"../internal/utils"
 
 	"github.com/cihub/seelog"
@@ -15,6 +18,8 @@ var (
 	errUnbalancedQuotes       = &errProtocol{"unbalanced quotes in request"}
 	errInvalidBulkLength      = &errProtocol{"invalid bulk length"}
 	errInvalidMultiBulkLength = &errProtocol{"invalid multibulk length"}
+	errTooBigInline           = &errProtocol{"too big inline request"}
+	errQueryBufferLimit       = &errProtocol{"query buffer limit exceeded"}
 	errDetached               = errors.New("detached")
 	errIncompleteCommand      = errors.New("incomplete command")
 	errTooMuchData            = errors.New("too much data")
@@ -37,10 +42,38 @@ type clientConn struct {
 	id     uint32
 	server *Server
 	conn   net.Conn
+	stat   *countingConn
+	info   clientInfo
 	wr     *Writer
 	rd     *Reader
 	ctx    interface{}
 	cmds   []Command
+	// runs the pipelined data commands concurrently
+	pipeline *pipeline
+	user     string
+	quit     bool
+
+	multi      bool
+	multiDirty bool
+	queued     []queuedCmd
+	watched    map[string]watchedKey
+	// records the hustdb requests of the command being dispatched, which
+	// EXEC and WATCH make on its behalf
+	trace *comm.Trace
+
+	// streams the commands of all clients, see MONITOR
+	monitor bool
+
+	// wrlock guards wr, which the subscription push goroutine shares
+	wrlock   sync.Mutex
+	closed   chan struct{}
+	pushCh   chan *Result
+	channels map[string]bool
+	patterns map[string]bool
+
+	// when the replies went above the soft output limit, zero if they are
+	// below it
+	softSince time.Time
 }
 
 func (cc *clientConn) Run() {
@@ -52,27 +85,67 @@ func (cc *clientConn) Run() {
 	}()
 	err = func() error {
 		for {
+			limits := cc.server.clientLimits()
+			cc.rd.limits = limits.proto
+			cc.setIdleDeadline(limits.timeout)
+			// Shutdown sets closing before it expires the deadlines, so
+			// either it sees the deadline above or we see closing here
+			if cc.server.isClosing() {
+				return nil
+			}
 			cmds, err := cc.rd.readCommands(nil)
 			if err != nil {
 				if err, ok := err.(*errProtocol); ok {
+					atomic.AddUint64(&cc.server.stats.protocolErrors, 1)
+					seelog.Warnf("client %d %v: %v", cc.id, cc.conn.RemoteAddr(), err)
+					cc.wrlock.Lock()
 					cc.wr.WriteError("ERR " + err.Error())
 					cc.wr.Flush()
+					cc.wrlock.Unlock()
 				}
 				return err
 			}
 			cc.cmds = cmds
-			for len(cc.cmds) > 0 {
+			cc.wrlock.Lock()
+			for len(cc.cmds) > 0 && !cc.quit {
 				cmd := cc.cmds[0]
 				if len(cc.cmds) == 1 {
 					cc.cmds = nil
 				} else {
 					cc.cmds = cc.cmds[1:]
 				}
-				cc.dispatch(cmd)
+				// a lone command is not worth a goroutine
+				var handler *CmdHandler
+				var name string
+				if len(cc.cmds) > 0 || cc.pipeline.pending() > 0 {
+					handler, name = cc.concurrentHandler(cmd)
+				}
+				if handler != nil {
+					if err = cc.pipeline.makeRoom(); err == nil {
+						cc.pipeline.start(handler, name, cmd.Args)
+						err = cc.pipeline.writeReplies(false)
+					}
+				} else if err = cc.pipeline.writeReplies(true); err == nil {
+					cc.dispatch(cmd)
+					err = cc.checkOutput()
+				}
+				if err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = cc.pipeline.writeReplies(true)
 			}
-			if err := cc.wr.Flush(); err != nil {
+			if err == nil {
+				err = cc.flush()
+			}
+			cc.wrlock.Unlock()
+			if err != nil {
 				return err
 			}
+			if cc.quit {
+				return nil
+			}
 		}
 	}()
 }
@@ -84,37 +157,125 @@ func (cc *clientConn) dispatch(cmd Command) error {
 		cc.server.releaseToken(token)
 		seelog.Debugf("cost: %v ms", time.Since(startTS).Nanoseconds()/time.Millisecond.Nanoseconds())
 	}()
-	if handler, ok := CmdMap[utils.BytesToString(bytes.ToLower(cmd.Args[0]))]; ok {
-		if err := handler.check(cmd.Args); err != nil {
-			cc.wr.WriteError(err.Error())
-			return nil
+	atomic.AddUint64(&cc.server.stats.commands, 1)
+	name := utils.BytesToString(bytes.ToLower(cmd.Args[0]))
+	cc.updateInfo(name)
+	defer cc.updateInfo("")
+	handler, err := cc.lookup(name, cmd.Args)
+	if err != nil {
+		if cc.multi {
+			cc.multiDirty = true
 		}
-		res := handler.handleFunc(cmd.Args)
-		if res.status&errStatus != 0 {
-			cc.wr.WriteError(utils.BytesToString(res.data))
-		} else if res.status&successStatus != 0 {
-			cc.wr.WriteBytes(res.data)
-		} else if res.status&integerStatus != 0 {
-			cc.wr.WriteInt(res.integer)
-		} else if res.status&nilStatus != 0 {
-			cc.wr.WriteNULL()
-		} else if res.status&arrayStatus != 0 {
-			cnt := len(res.array)
-			cc.wr.WriteArray(cnt)
-			for _, item := range res.array {
-				cc.wr.WriteBulk([]byte(item))
+		cc.server.recordRejected(name)
+		cc.wr.WriteError(err.Error())
+		return nil
+	}
+	if cc.subscriptions() > 0 && !subModeCmds[name] {
+		cc.server.recordRejected(name)
+		cc.wr.WriteError("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context")
+		return nil
+	}
+	if cc.monitor && name != "quit" {
+		cc.server.recordRejected(name)
+		cc.wr.WriteError("ERR only QUIT allowed in MONITOR mode")
+		return nil
+	}
+	if cc.multi && handler.spec.hasFlag("no_multi") {
+		// EXEC would switch the connection's mode halfway through the queue
+		cc.multiDirty = true
+		cc.server.recordRejected(name)
+		cc.wr.WriteError("ERR Command not allowed inside a transaction")
+		return nil
+	}
+	if cc.multi && !multiCtrlCmds[name] {
+		// MONITOR sees the command when EXEC runs it
+		cc.queued = append(cc.queued, queuedCmd{handler: handler, args: cmd.Args})
+		cc.wr.WriteString("QUEUED")
+		return nil
+	}
+	// like in redis, EXEC shows up after the commands it ran
+	if name != "exec" && cc.server.monitoring() {
+		cc.server.feedMonitors(cc, cmd.Args)
+	}
+	cc.trace = cc.server.slowlog.newTrace()
+	handleTS := time.Now()
+	res := handler.handle(cc, cmd.Args, cc.trace)
+	elapsed := time.Since(handleTS)
+	if name == "exec" && cc.server.monitoring() {
+		cc.server.feedMonitors(cc, cmd.Args)
+	}
+	cc.server.recordCall(name, elapsed, res)
+	cc.server.slowlog.record(cc, cmd.Args, elapsed, cc.trace)
+	cc.trace = nil
+	cc.writeResult(res)
+	return nil
+}
+
+// lookup finds the handler for the command and makes sure the connection
+// may run it with these arguments.
+func (cc *clientConn) lookup(name string, args [][]byte) (*CmdHandler, error) {
+	handler, ok := CmdMap[name]
+	// authentication comes first, so which commands exist is not told to a
+	// client that did not log in
+	noAuth := ok && handler.spec.hasFlag("no_auth")
+	if cc.user == "" && !noAuth {
+		return nil, errNoAuth
+	}
+	if !ok {
+		return nil, errors.New("ERR unknown command '" + string(args[0]) + "'")
+	}
+	if err := handler.check(args); err != nil {
+		return nil, err
+	}
+	if !noAuth {
+		if err := cc.server.acl.Check(cc.user, name, args); err != nil {
+			return nil, err
+		}
+	}
+	return handler, nil
+}
+
+func (cc *clientConn) writeResult(res *Result) {
+	if res == nil {
+		cc.wr.WriteNULL()
+		return
+	}
+	if res.status&errStatus != 0 {
+		cc.wr.WriteError(utils.BytesToString(res.data))
+	} else if res.status&successStatus != 0 {
+		cc.wr.WriteBytes(res.data)
+	} else if res.status&bulkStatus != 0 {
+		cc.wr.WriteBulk(res.data)
+	} else if res.status&integerStatus != 0 {
+		cc.wr.WriteInt(res.integer)
+	} else if res.status&nilStatus != 0 {
+		cc.wr.WriteNULL()
+	} else if res.status&nilArrayStatus != 0 {
+		cc.wr.WriteNullArray()
+	} else if res.status&arrayStatus != 0 {
+		cc.wr.WriteArray(len(res.array))
+		for _, item := range res.array {
+			if item != nil && item.status&repliesStatus != 0 {
+				item = &Result{status: arrayStatus, array: item.array}
 			}
+			cc.writeResult(item)
+		}
+	} else if res.status&repliesStatus != 0 {
+		for _, item := range res.array {
+			cc.writeResult(item)
 		}
-	} else {
-		cc.wr.WriteError("ERR unknown command '" + string(cmd.Args[0]) + "'")
 	}
-	return nil
 }
 
 func (cc *clientConn) Close() error {
 	cc.server.rwlock.Lock()
 	delete(cc.server.clients, cc.id)
 	cc.server.rwlock.Unlock()
+	cc.unsubscribeAll()
+	if cc.monitor {
+		cc.server.removeMonitor(cc)
+	}
+	close(cc.closed)
 	cc.conn.Close()
 	return nil
 }
@@ -0,0 +1,150 @@
+//go:build ignore
+// +build ignore
+
+// gencommands derives commands_gen.go and doc/redis.json from the command
+// spec in doc/commands.json. Run it with go generate in this directory.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+const (
+	specFile = "../doc/commands.json"
+	goFile   = "commands_gen.go"
+	docFile  = "../doc/redis.json"
+)
+
+type command struct {
+	Name       string
+	Arity      int
+	MaxArgs    int `json:"max_args"`
+	Flags      []string
+	FirstKey   int `json:"first_key"`
+	LastKey    int `json:"last_key"`
+	Step       int
+	Categories []string
+	Params     interface{}
+	Usage      string
+	Return     interface{}
+	Returns    string
+	// caveats of the proxy's implementation, a comment line in the docs
+	Notes string
+}
+
+func main() {
+	data, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var cmds []*command
+	if err := json.Unmarshal(data, &cmds); err != nil {
+		log.Fatalf("%s: %v", specFile, err)
+	}
+	seen := map[string]bool{}
+	for _, cmd := range cmds {
+		if cmd.Name == "" || cmd.Name != strings.ToLower(cmd.Name) || seen[cmd.Name] {
+			log.Fatalf("%s: bad or duplicate name %q", specFile, cmd.Name)
+		}
+		if cmd.Arity == 0 || (cmd.MaxArgs != 0 && (cmd.Arity > 0 || cmd.MaxArgs < -cmd.Arity)) {
+			log.Fatalf("%s: bad arity for %s", specFile, cmd.Name)
+		}
+		if len(cmd.Categories) == 0 {
+			log.Fatalf("%s: %s has no acl category", specFile, cmd.Name)
+		}
+		if (cmd.FirstKey == 0) != (cmd.Step == 0) {
+			log.Fatalf("%s: bad key positions for %s", specFile, cmd.Name)
+		}
+		seen[cmd.Name] = true
+	}
+	if err := ioutil.WriteFile(goFile, genGo(cmds), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(docFile, genDoc(cmds), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func genGo(cmds []*command) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gencommands.go from doc/commands.json. DO NOT EDIT.\n\n")
+	buf.WriteString("package server\n\n")
+	buf.WriteString("var commandSpecs = []*commandSpec{\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(&buf, "{name: %q, arity: %d, maxArgs: %d, flags: %#v, firstKey: %d, lastKey: %d, step: %d, categories: %#v},\n",
+			cmd.Name, cmd.Arity, cmd.MaxArgs, cmd.Flags, cmd.FirstKey, cmd.LastKey, cmd.Step, cmd.Categories)
+	}
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return src
+}
+
+// genDoc writes the commented json the docs have always used.
+func genDoc(cmds []*command) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("// Generated from doc/commands.json by server/gencommands.go, edit that file instead.\n")
+	buf.WriteString("{\n")
+	for i, cmd := range cmds {
+		sep := ","
+		if i == len(cmds)-1 {
+			sep = ""
+		}
+		if cmd.Notes != "" {
+			fmt.Fprintf(&buf, "    //%s\n", cmd.Notes)
+		}
+		if cmd.Params == nil && cmd.Return == nil {
+			fmt.Fprintf(&buf, "    %q: {}%s%s\n", cmd.Name, sep, comment(cmd.Usage))
+			continue
+		}
+		fmt.Fprintf(&buf, "    %q: {\n", cmd.Name)
+		if cmd.Params != nil {
+			comma := ","
+			if cmd.Return == nil {
+				comma = ""
+			}
+			fmt.Fprintf(&buf, "        \"params\": %s%s%s\n", docValue(cmd.Params), comma, comment(cmd.Usage))
+		}
+		if cmd.Return != nil {
+			fmt.Fprintf(&buf, "        \"return\": %s%s\n", docValue(cmd.Return), comment(cmd.Returns))
+		}
+		fmt.Fprintf(&buf, "    }%s\n", sep)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func comment(text string) string {
+	if text == "" {
+		return ""
+	}
+	return " //" + text
+}
+
+// docValue renders params and returns on one line, e.g. ["string", "nil"].
+func docValue(v interface{}) string {
+	switch v := v.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, docValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			log.Fatal(err)
+		}
+		return strings.TrimSpace(buf.String())
+	}
+}
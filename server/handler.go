@@ -5,37 +5,48 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
-	"strings"
 
+	"../hustdb/comm"
 	db "../hustdb/handler"
-	"../internal/utils"
 )
 
 type Result struct {
 	data    []byte
 	status  uint32
 	integer int
-	array   []string
+	array   []*Result
 }
 
 const (
-	successStatus = 0x01
-	nilStatus     = 0x02
-	integerStatus = 0x04
-	arrayStatus   = 0x10
-	errStatus     = 0x20
+	successStatus  = 0x01 // status reply, e.g. +OK
+	nilStatus      = 0x02
+	integerStatus  = 0x04
+	bulkStatus     = 0x08 // binary safe data reply
+	arrayStatus    = 0x10 // elements may be nil or nested arrays
+	errStatus      = 0x20
+	nilArrayStatus = 0x40
+	repliesStatus  = 0x80 // each array element is a reply of its own
 )
 
-type CheckFunc func(args [][]byte) error
-type HandleFunc func(args [][]byte) *Result
+// CheckFunc validates the arguments beyond their count and returns their
+// values, see argSchema.
+type CheckFunc func(args [][]byte) (*Args, error)
+
+// HandleFunc gets the values checkFunc parsed, nil for a command without
+// one.
+type HandleFunc func(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result
+type ConnHandleFunc func(cc *clientConn, args [][]byte) *Result
 
 type CmdHandler struct {
-	cmdName    string
-	minParams  int
-	maxParams  int
-	handleFunc HandleFunc
-	checkFunc  CheckFunc
+	cmdName        string
+	minParams      int
+	maxParams      int
+	handleFunc     HandleFunc
+	connHandleFunc ConnHandleFunc
+	checkFunc      CheckFunc
+	spec           *commandSpec
 }
 
 func (this *CmdHandler) check(args [][]byte) error {
@@ -56,133 +67,193 @@ func NewCmdHandler(cmdName string, minParams, maxParams int, check CheckFunc, ha
 	}
 }
 
+// NewConnCmdHandler registers a command that needs the calling connection,
+// e.g. to read or change its per-connection state.
+func NewConnCmdHandler(cmdName string, minParams, maxParams int, check CheckFunc, handle ConnHandleFunc) *CmdHandler {
+	return &CmdHandler{
+		cmdName:        cmdName,
+		minParams:      minParams,
+		maxParams:      maxParams,
+		checkFunc:      check,
+		connHandleFunc: handle,
+	}
+}
+
+// handle runs the command, recording its hustdb requests in trace when it
+// is not nil. The keys of a write command are locked while it runs.
+func (this *CmdHandler) handle(cc *clientConn, args [][]byte, trace *comm.Trace) *Result {
+	if written := this.writtenKeys(args); len(written) > 0 {
+		defer KeyLock.LockKeys(nil, written)()
+	}
+	return this.run(cc, args, trace)
+}
+
+// writtenKeys returns the keys the command writes, none for a read.
+func (this *CmdHandler) writtenKeys(args [][]byte) [][]byte {
+	if this.spec == nil || !this.spec.hasFlag("write") {
+		return nil
+	}
+	return commandKeys(this.spec.name, args)
+}
+
+// run is handle for callers holding the key locks already. Like in redis,
+// arguments failing checkFunc are an error of the command itself, not of
+// the MULTI queueing it.
+func (this *CmdHandler) run(cc *clientConn, args [][]byte, trace *comm.Trace) *Result {
+	var parsed *Args
+	if this.checkFunc != nil {
+		var err error
+		if parsed, err = this.checkFunc(args); err != nil {
+			return &Result{
+				status: errStatus,
+				data:   []byte(err.Error()),
+			}
+		}
+	}
+	if this.connHandleFunc != nil {
+		return this.connHandleFunc(cc, args)
+	}
+	return this.handleFunc(IDBHandle.WithTrace(trace), args, parsed)
+}
+
 var (
-	CmdMap = map[string]*CmdHandler{
-		"set":           NewCmdHandler("set", 3, 0, nil, setHandle),
-		"get":           NewCmdHandler("get", 2, 2, nil, getHandle),
-		"exists":        NewCmdHandler("exists", 2, 2, nil, existsHandle),
-		"del":           NewCmdHandler("del", 2, 0, nil, delHandle),
-		"strlen":        NewCmdHandler("strlen", 2, 2, nil, strlenHandle),
-		"hdel":          NewCmdHandler("hdel", 3, 0, nil, hdelHandle),
-		"hexists":       NewCmdHandler("hexists", 3, 3, nil, hexistsHandle),
-		"hget":          NewCmdHandler("hget", 3, 3, nil, hgetHandle),
-		"hincrby":       NewCmdHandler("hincrby", 4, 4, nil, hincrbyHandle),
-		"hset":          NewCmdHandler("hset", 4, 4, nil, hsetHandle),
-		"sadd":          NewCmdHandler("sadd", 3, 0, nil, saddHandle),
-		"sismember":     NewCmdHandler("sismember", 3, 3, nil, sismemberHandle),
-		"srem":          NewCmdHandler("srem", 3, 0, nil, sremHandle),
-		"zadd":          NewCmdHandler("zadd", 4, 0, nil, zaddHandle),
-		"zrange":        NewCmdHandler("zrange", 4, 5, nil, zrangeHandle),
-		"zrangebyscore": NewCmdHandler("zrangebyscore", 4, 0, nil, zrangeByScoreHandle),
-		"zrem":          NewCmdHandler("zrem", 3, 0, nil, zremHandle),
-		"zscore":        NewCmdHandler("zscore", 3, 3, nil, zscoreHandle),
-		"zincrby":       NewCmdHandler("zincrbyHandle", 4, 4, nil, zincrbyHandle),
-
-		"hlen":  NewCmdHandler("hlen", 2, 2, nil, hlenHandle),
-		"scard": NewCmdHandler("scard", 2, 2, nil, scardHandle),
-		"zcard": NewCmdHandler("zcard", 2, 2, nil, zcardHandle),
-		"rpush": NewCmdHandler("rpushHandle", 3, 0, nil, nil),
-		"lpop":  NewCmdHandler("lpopHandle", 3, 0, nil, nil),
-		"llen":  NewCmdHandler("llenHandle", 3, 0, nil, nil),
-
-		"echo": NewCmdHandler("echo", 2, 2, nil, echoHandle),
-		"ping": NewCmdHandler("ping", 1, 1, nil, pingHandle),
+	// CmdMap is built from commandSpecs and the implementations below
+	CmdMap = map[string]*CmdHandler{}
+
+	handleFuncs = map[string]HandleFunc{
+		"set":           setHandle,
+		"get":           getHandle,
+		"exists":        existsHandle,
+		"del":           delHandle,
+		"strlen":        strlenHandle,
+		"hdel":          hdelHandle,
+		"hexists":       hexistsHandle,
+		"hget":          hgetHandle,
+		"hincrby":       hincrbyHandle,
+		"hset":          hsetHandle,
+		"sadd":          saddHandle,
+		"sismember":     sismemberHandle,
+		"srem":          sremHandle,
+		"zadd":          zaddHandle,
+		"zrange":        zrangeHandle,
+		"zrangebyscore": zrangeByScoreHandle,
+		"zrem":          zremHandle,
+		"zscore":        zscoreHandle,
+		"zincrby":       zincrbyHandle,
+		"hlen":          hlenHandle,
+		"scard":         scardHandle,
+		"zcard":         zcardHandle,
+		"echo":          echoHandle,
+		"getver":        getverHandle,
+		"cas":           casHandle,
+		"cad":           cadHandle,
+	}
+	connHandleFuncs = map[string]ConnHandleFunc{
+		"ping":         pingHandle,
+		"auth":         authHandle,
+		"acl":          aclHandle,
+		"multi":        multiHandle,
+		"exec":         execHandle,
+		"discard":      discardHandle,
+		"watch":        watchHandle,
+		"unwatch":      unwatchHandle,
+		"subscribe":    subscribeHandle,
+		"unsubscribe":  unsubscribeHandle,
+		"psubscribe":   psubscribeHandle,
+		"punsubscribe": punsubscribeHandle,
+		"publish":      publishHandle,
+		"pubsub":       pubsubHandle,
+		"client":       clientHandle,
+		"info":         infoHandle,
+		"shutdown":     shutdownHandle,
+		"config":       configHandle,
+		"slowlog":      slowlogHandle,
+		"monitor":      monitorHandle,
+		"quit":         quitHandle,
+		"command":      commandHandle,
+		"latency":      latencyHandle,
+	}
+
+	// schemas of the commands taking more than strings, checked before
+	// the handler runs
+	argSchemas = map[string]*argSchema{
+		"set": {
+			params: []argKind{argString, argString},
+			options: []*argOption{
+				{name: "nx", group: "condition"},
+				{name: "xx", group: "condition"},
+				{name: "ex", params: []argKind{argInt}, group: "expire"},
+				{name: "px", params: []argKind{argInt}, group: "expire"},
+			},
+		},
+		"cas":     {params: []argKind{argString, argInt, argString}},
+		"hincrby": {params: []argKind{argString, argString, argInt}},
+		"zadd": {
+			params: []argKind{argString},
+			repeat: []argKind{argFloat, argString},
+		},
+		"zrange": {
+			params:  []argKind{argString, argInt, argInt},
+			options: []*argOption{{name: "withscores"}},
+		},
+		"zrangebyscore": {
+			params: []argKind{argString, argScoreBound, argScoreBound},
+			options: []*argOption{
+				{name: "withscores"},
+				{name: "limit", params: []argKind{argInt, argInt}},
+			},
+		},
+		"zincrby": {params: []argKind{argString, argFloat, argString}},
 	}
+
 	// IDBHandle = &DBHandle{}
 	IDBHandle = db.NewHustdbHandler()
+	KeyLock   = NewKeyLocker(1024)
 )
 
-func setHandle(args [][]byte) *Result {
-	argc := len(args)
+func setHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"key": args[1],
 	}
-	checkNxXx := func(pos int) *Result {
-		arg := bytes.ToLower(args[pos])
-		if bytes.Compare(arg, []byte("nx")) == 0 {
-			resp := IDBHandle.HustdbExist(params)
-			if resp.Code == 200 {
-				return &Result{
-					status: nilStatus,
-				}
-			}
-		} else if bytes.Compare(arg, []byte("xx")) == 0 {
-			resp := IDBHandle.HustdbExist(params)
-			if resp.Code != 200 {
-				return &Result{
-					status: nilStatus,
-				}
-			}
-		} else {
+	if pos := parsed.Option("ex"); pos > 0 {
+		ttl := parsed.Int(pos + 1)
+		if ttl <= 0 {
 			return &Result{
 				status: errStatus,
-				data:   []byte("ERR syntax error"),
+				data:   []byte("ERR invalid expire time in 'set' command"),
 			}
 		}
-		return nil
-	}
-	checkTTL := func(pos int) *Result {
-		arg := bytes.ToLower(args[pos])
-		if bytes.Compare(arg, []byte("ex")) == 0 {
-			_, err := strconv.ParseInt(utils.BytesToString(args[pos+1]), 10, 64)
-			if err != nil {
-				return &Result{
-					status: errStatus,
-					data:   []byte("ERR value is not an integer or out of range"),
-				}
-			}
-			params["ttl"] = args[pos+1]
-		} else if bytes.Compare(arg, []byte("px")) == 0 {
-			val, err := strconv.ParseInt(utils.BytesToString(args[pos+1]), 10, 64)
-			if err != nil {
-				return &Result{
-					status: errStatus,
-					data:   []byte("ERR value is not an integer or out of range"),
-				}
-			}
-			val = val / 1000
-			if val == 0 {
-				val = 1
-			}
-			params["ttl"] = []byte(strconv.FormatInt(val, 10))
-		} else {
+		params["ttl"] = []byte(strconv.FormatInt(ttl, 10))
+	} else if pos := parsed.Option("px"); pos > 0 {
+		ttl := parsed.Int(pos + 1)
+		if ttl <= 0 {
 			return &Result{
 				status: errStatus,
-				data:   []byte("ERR syntax error"),
+				data:   []byte("ERR invalid expire time in 'set' command"),
 			}
 		}
-		return nil
+		ttl = ttl / 1000
+		if ttl == 0 {
+			ttl = 1
+		}
+		params["ttl"] = []byte(strconv.FormatInt(ttl, 10))
 	}
+	nx, xx := parsed.Has("nx"), parsed.Has("xx")
 
-	for i := 3; i < argc; i++ {
-		arg := bytes.ToLower(args[i])
-		if bytes.Compare(arg, []byte("nx")) == 0 || bytes.Compare(arg, []byte("xx")) == 0 {
-			if result := checkNxXx(i); result != nil {
-				return result
-			}
-		} else if bytes.Compare(arg, []byte("ex")) == 0 || bytes.Compare(arg, []byte("px")) == 0 {
-			//At least ex have one argument
-			if i >= argc-1 {
-				return &Result{
-					status: errStatus,
-					data:   []byte("ERR syntax error"),
-				}
-			} else {
-				if result := checkTTL(i); result != nil {
-					return result
-				}
-				i += 1
-			}
-
-		} else {
+	// the existence check and the put run under the key lock handle takes,
+	// so two SET NX through this proxy can not both succeed. KeyLock is
+	// local to the process, another proxy in front of the same hustdb
+	// still races.
+	if nx || xx {
+		resp := hdb.HustdbExist(map[string][]byte{"key": args[1]})
+		if (nx && resp.Code == 200) || (xx && resp.Code != 200) {
 			return &Result{
-				status: errStatus,
-				data:   []byte("ERR syntax error"),
+				status: nilStatus,
 			}
 		}
 	}
 	params["val"] = args[2]
-	resp := IDBHandle.HustdbPut(params)
+	resp := hdb.HustdbPut(params)
 	if resp.Code == 200 {
 		return &Result{
 			status: successStatus,
@@ -195,14 +266,14 @@ func setHandle(args [][]byte) *Result {
 	}
 }
 
-func getHandle(args [][]byte) *Result {
+func getHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"key": args[1],
 	}
-	resp := IDBHandle.HustdbGet(params)
+	resp := hdb.HustdbGet(params)
 	if resp.Code == 200 {
 		return &Result{
-			status: successStatus,
+			status: bulkStatus,
 			data:   resp.Data,
 		}
 	} else {
@@ -212,14 +283,14 @@ func getHandle(args [][]byte) *Result {
 	}
 }
 
-func existsHandle(args [][]byte) *Result {
+func existsHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"key": args[1],
 	}
 	result := &Result{
 		status: integerStatus,
 	}
-	resp := IDBHandle.HustdbExist(params)
+	resp := hdb.HustdbExist(params)
 	if resp.Code == 200 {
 		result.integer = 1
 	} else {
@@ -228,7 +299,7 @@ func existsHandle(args [][]byte) *Result {
 	return result
 }
 
-func delHandle(args [][]byte) *Result {
+func delHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	var delCnt int
 	argc := len(args[1:])
 	ch := make(chan int, argc)
@@ -237,7 +308,7 @@ func delHandle(args [][]byte) *Result {
 			"key": key,
 		}
 		go func(params map[string][]byte) {
-			resp := IDBHandle.HustdbDel(params)
+			resp := hdb.HustdbDel(params)
 			ch <- resp.Code
 		}(params)
 	}
@@ -254,14 +325,14 @@ func delHandle(args [][]byte) *Result {
 	}
 }
 
-func strlenHandle(args [][]byte) *Result {
+func strlenHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"key": args[1],
 	}
 	result := &Result{
 		status: integerStatus,
 	}
-	resp := IDBHandle.HustdbGet(params)
+	resp := hdb.HustdbGet(params)
 	if resp.Code == 200 {
 		result.integer = len(resp.Data)
 	} else {
@@ -270,7 +341,91 @@ func strlenHandle(args [][]byte) *Result {
 	return result
 }
 
-func hdelHandle(args [][]byte) *Result {
+// keyVersion returns the highest version of the string key over its
+// backends, 0 if it does not exist.
+func keyVersion(hdb *db.HustdbHandler, key []byte) int {
+	params := map[string][]byte{
+		"key": key,
+	}
+	resp := hdb.HustdbGet2(params)
+	if resp.Code != 200 {
+		return 0
+	}
+	return resp.Version
+}
+
+func getverHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
+	params := map[string][]byte{
+		"key": args[1],
+	}
+	resp := hdb.HustdbGet2(params)
+	if resp.Code != 200 {
+		return &Result{
+			status: nilStatus,
+		}
+	}
+	return &Result{
+		status: arrayStatus,
+		array: []*Result{
+			{status: bulkStatus, data: resp.Data},
+			{status: integerStatus, integer: resp.Version},
+		},
+	}
+}
+
+// casHandle sets the key only when its version still equals the expected
+// one, 0 standing for a missing key. Check and write run under KeyLock like
+// every other write, so they are atomic within the proxy, not across
+// proxies sharing the backends.
+func casHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
+	expected := parsed.Int(2)
+	if int64(keyVersion(hdb, args[1])) != expected {
+		return &Result{
+			status:  integerStatus,
+			integer: 0,
+		}
+	}
+	params := map[string][]byte{
+		"key": args[1],
+		"val": args[3],
+	}
+	resp := hdb.HustdbPut(params)
+	if resp.Code != 200 {
+		return &Result{
+			status: nilStatus,
+		}
+	}
+	return &Result{
+		status:  integerStatus,
+		integer: 1,
+	}
+}
+
+// cadHandle deletes the key only if it still holds the given value, which
+// is how a lock taken with SET NX is released safely. Like casHandle it is
+// atomic within the proxy only.
+func cadHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
+	resp := hdb.HustdbGet2(map[string][]byte{"key": args[1]})
+	if resp.Code != 200 || !bytes.Equal(resp.Data, args[2]) {
+		return &Result{
+			status:  integerStatus,
+			integer: 0,
+		}
+	}
+	resp = hdb.HustdbDel(map[string][]byte{"key": args[1]})
+	if resp.Code != 200 {
+		return &Result{
+			status:  integerStatus,
+			integer: 0,
+		}
+	}
+	return &Result{
+		status:  integerStatus,
+		integer: 1,
+	}
+}
+
+func hdelHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	argc := len(args[2:])
 	var delCnt int
 	ch := make(chan int, argc)
@@ -280,7 +435,7 @@ func hdelHandle(args [][]byte) *Result {
 			"key": key,
 		}
 		go func(params map[string][]byte) {
-			resp := IDBHandle.HustdbHdel(params)
+			resp := hdb.HustdbHdel(params)
 			ch <- resp.Code
 		}(params)
 	}
@@ -295,7 +450,7 @@ func hdelHandle(args [][]byte) *Result {
 	}
 }
 
-func hexistsHandle(args [][]byte) *Result {
+func hexistsHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"tb":  args[1],
 		"key": args[2],
@@ -303,21 +458,21 @@ func hexistsHandle(args [][]byte) *Result {
 	result := &Result{
 		status: integerStatus,
 	}
-	if resp := IDBHandle.HustdbHexist(params); resp.Code == 200 {
+	if resp := hdb.HustdbHexist(params); resp.Code == 200 {
 		result.integer = 1
 	}
 	return result
 }
 
-func hgetHandle(args [][]byte) *Result {
+func hgetHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"tb":  args[1],
 		"key": args[2],
 	}
-	resp := IDBHandle.HustdbHget(params)
+	resp := hdb.HustdbHget(params)
 	if resp.Code == 200 {
 		return &Result{
-			status: successStatus,
+			status: bulkStatus,
 			data:   resp.Data,
 		}
 	} else {
@@ -327,37 +482,31 @@ func hgetHandle(args [][]byte) *Result {
 	}
 }
 
-func hincrbyHandle(args [][]byte) *Result {
+func hincrbyHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	result := &Result{}
-	_, err := strconv.ParseInt(utils.BytesToString(args[3]), 10, 64)
-	if err != nil {
-		result.status = errStatus
-		result.data = []byte("ERR hash value is not an integer")
-		return result
-	}
 	params := map[string][]byte{
 		"tb":  args[1],
 		"key": args[2],
-		"val": args[3],
+		"val": []byte(strconv.FormatInt(parsed.Int(3), 10)),
 	}
-	resp := IDBHandle.HustdbHincrby(params)
+	resp := hdb.HustdbHincrby(params)
 	if resp.Code == 200 {
-		result.status = successStatus
+		result.status = bulkStatus
 		result.data = resp.Data
 	} else {
-		result.status = successStatus
+		result.status = bulkStatus
 		result.data = []byte("0")
 	}
 	return result
 }
 
-func hsetHandle(args [][]byte) *Result {
+func hsetHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"tb":  args[1],
 		"key": args[2],
 		"val": args[3],
 	}
-	resp := IDBHandle.HustdbHset(params)
+	resp := hdb.HustdbHset(params)
 	if resp.Code == 200 && resp.Version == 1 {
 		return &Result{
 			status:  integerStatus,
@@ -371,7 +520,7 @@ func hsetHandle(args [][]byte) *Result {
 	}
 }
 
-func hlenHandle(args [][]byte) *Result {
+func hlenHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	result := &Result{
 		status:  integerStatus,
 		integer: 0,
@@ -379,7 +528,7 @@ func hlenHandle(args [][]byte) *Result {
 	params := map[string][]byte{
 		"tb": args[1],
 	}
-	resp := IDBHandle.HustdbStat(params)
+	resp := hdb.HustdbStat(params)
 	if resp.Code == 200 {
 		hashSize, err := strconv.Atoi(string(resp.Data))
 		if err == nil {
@@ -391,7 +540,7 @@ func hlenHandle(args [][]byte) *Result {
 	return result
 }
 
-func saddHandle(args [][]byte) *Result {
+func saddHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	var addCnt int
 	argc := len(args[2:])
 	ch := make(chan int, argc)
@@ -401,7 +550,7 @@ func saddHandle(args [][]byte) *Result {
 			"key": key,
 		}
 		go func(params map[string][]byte) {
-			resp := IDBHandle.HustdbSadd(params)
+			resp := hdb.HustdbSadd(params)
 			if resp.Version == 1 {
 				ch <- resp.Code
 			} else {
@@ -420,12 +569,12 @@ func saddHandle(args [][]byte) *Result {
 	}
 }
 
-func sismemberHandle(args [][]byte) *Result {
+func sismemberHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"tb":  args[1],
 		"key": args[2],
 	}
-	resp := IDBHandle.HustdbSismember(params)
+	resp := hdb.HustdbSismember(params)
 	result := &Result{
 		status: integerStatus,
 	}
@@ -435,7 +584,7 @@ func sismemberHandle(args [][]byte) *Result {
 	return result
 }
 
-func sremHandle(args [][]byte) *Result {
+func sremHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	var remCnt int
 	argc := len(args[2:])
 	ch := make(chan int, argc)
@@ -445,7 +594,7 @@ func sremHandle(args [][]byte) *Result {
 			"key": key,
 		}
 		go func(params map[string][]byte) {
-			resp := IDBHandle.HustdbSrem(params)
+			resp := hdb.HustdbSrem(params)
 			ch <- resp.Code
 		}(params)
 	}
@@ -460,7 +609,7 @@ func sremHandle(args [][]byte) *Result {
 	}
 }
 
-func scardHandle(args [][]byte) *Result {
+func scardHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	result := &Result{
 		status:  integerStatus,
 		integer: 0,
@@ -468,7 +617,7 @@ func scardHandle(args [][]byte) *Result {
 	params := map[string][]byte{
 		"tb": args[1],
 	}
-	resp := IDBHandle.HustdbStat(params)
+	resp := hdb.HustdbStat(params)
 	if resp.Code == 200 {
 		setSize, err := strconv.Atoi(string(resp.Data))
 		if err == nil {
@@ -480,31 +629,18 @@ func scardHandle(args [][]byte) *Result {
 	return result
 }
 
-func zaddHandle(args [][]byte) *Result {
+func zaddHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	var addCnt int
 	argc := len(args[2:])
-	if argc%2 != 0 {
-		return &Result{
-			status: errStatus,
-			data:   []byte("ERR syntax error"),
-		}
-	}
 	ch := make(chan int, argc/2)
-	for i := 0; i < argc; i += 2 {
-		_, err := strconv.ParseFloat(utils.BytesToString(args[2+i]), 64)
-		if err != nil {
-			return &Result{
-				status: errStatus,
-				data:   []byte("ERR value is not a valid float"),
-			}
-		}
+	for i := 2; i < len(args); i += 2 {
 		params := map[string][]byte{
 			"tb":    args[1],
-			"score": args[2+i],
-			"key":   args[3+i],
+			"score": args[i],
+			"key":   args[i+1],
 		}
 		go func(params map[string][]byte) {
-			resp := IDBHandle.HustdbZadd(params)
+			resp := hdb.HustdbZadd(params)
 			if resp.Version == 1 {
 				ch <- resp.Code
 			} else {
@@ -523,53 +659,39 @@ func zaddHandle(args [][]byte) *Result {
 	}
 }
 
-func zrangeHandle(args [][]byte) *Result {
-	var withscores bool
+func zrangeHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	var resArray []map[string]interface{}
-	argc := len(args)
 	result := &Result{
 		status: arrayStatus,
 	}
-	start, err := strconv.ParseInt(utils.BytesToString(args[2]), 10, 64)
-	if err != nil {
-		result.status = errStatus
-		result.data = []byte("ERR value is not an integer or out of range")
-		return result
-	}
-	end, err := strconv.ParseInt(utils.BytesToString(args[3]), 10, 64)
-	if err != nil {
-		result.status = errStatus
-		result.data = []byte("ERR value is not an integer or out of range")
-		return result
-	}
+	start, end := parsed.Int(2), parsed.Int(3)
 	if end < start {
 		return result
 	}
+	withscores := parsed.Has("withscores")
 	params := map[string][]byte{
 		"tb":     args[1],
-		"offset": args[2],
+		"offset": []byte(strconv.FormatInt(start, 10)),
 		"size":   []byte(strconv.FormatInt(end-start+1, 10)),
+		"noval":  []byte(strconv.FormatBool(!withscores)),
 	}
-	if argc == 4 {
-		params["noval"] = []byte("true")
-		withscores = false
-	} else {
-		if bytes.Compare([]byte("withscores"), bytes.ToLower(args[4])) != 0 {
-			result.status = errStatus
-			result.data = []byte("ERR syntax error")
-			return result
-		}
-		params["noval"] = []byte("false")
-		withscores = true
-	}
-	resp := IDBHandle.HustdbZrangebyrank(params)
+	resp := hdb.HustdbZrangebyrank(params)
 	if resp.Code == 200 {
 		json.Unmarshal(resp.Data, &resArray)
 	}
+	return zrangeResult(resArray, withscores)
+}
+
+// zrangeResult turns the members hustdb returned into the reply, with the
+// scores interleaved when asked for.
+func zrangeResult(resArray []map[string]interface{}, withscores bool) *Result {
+	result := &Result{
+		status: arrayStatus,
+	}
 	if withscores {
-		result.array = make([]string, 0, 2*len(resArray))
+		result.array = make([]*Result, 0, 2*len(resArray))
 	} else {
-		result.array = make([]string, 0, len(resArray))
+		result.array = make([]*Result, 0, len(resArray))
 	}
 	for _, item := range resArray {
 		key := item["key"].(string)
@@ -577,142 +699,58 @@ func zrangeHandle(args [][]byte) *Result {
 		if err != nil {
 			continue
 		}
-		result.array = append(result.array, utils.BytesToString(b))
+		result.array = append(result.array, &Result{status: bulkStatus, data: b})
 		if withscores {
-			result.array = append(result.array, item["val"].(string))
+			result.array = append(result.array, &Result{status: bulkStatus, data: []byte(item["val"].(string))})
 		}
 	}
 	return result
 }
 
-func zrangeByScoreHandle(args [][]byte) *Result {
-	var withscores bool
+func zrangeByScoreHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	var resArray []map[string]interface{}
-	argc := len(args)
-	result := &Result{
-		status: arrayStatus,
+	start, end := parsed.Bound(2), parsed.Bound(3)
+	if end.value < start.value {
+		return &Result{
+			status: arrayStatus,
+		}
 	}
-
-	var start, end float64
-	var err error
-	var start_open_flag bool = false
-	var end_open_flag bool = false
+	// hustdb scores are integers, so an exclusive end moves by one
 	var min, max string
-	if bytes.IndexByte(args[2], '(') == 0 {
-		args[2] = args[2][1:]
-		start_open_flag = true
-	}
-	start, err = strconv.ParseFloat(utils.BytesToString(args[2]), 64)
-	if err != nil {
-		result.status = errStatus
-		result.data = []byte("ERR min or max is not a float")
-		return result
-	}
-	if bytes.IndexByte(args[3], '(') == 0 {
-		args[3] = args[3][1:]
-		end_open_flag = true
-	}
-	end, err = strconv.ParseFloat(utils.BytesToString(args[3]), 64)
-	if err != nil {
-		result.status = errStatus
-		result.data = []byte("ERR min or max is not a float")
-		return result
-	}
-	if end < start {
-		return result
-	}
-
-	if strings.ToLower(utils.BytesToString(args[2])) == "-inf" {
+	if math.IsInf(start.value, -1) {
 		min = "-9223372036854775808"
-	} else if start_open_flag {
-		min = fmt.Sprintf("%f", start+1)
+	} else if start.exclusive {
+		min = fmt.Sprintf("%f", start.value+1)
 	} else {
-		min = fmt.Sprintf("%f", start)
+		min = fmt.Sprintf("%f", start.value)
 	}
-
-	if strings.ToLower(utils.BytesToString(args[3])) == "+inf" {
+	if math.IsInf(end.value, 1) {
 		max = "9223372036854775807"
-	} else if end_open_flag {
-		max = fmt.Sprintf("%f", end-1)
+	} else if end.exclusive {
+		max = fmt.Sprintf("%f", end.value-1)
 	} else {
-		max = fmt.Sprintf("%f", end)
+		max = fmt.Sprintf("%f", end.value)
 	}
 
+	withscores := parsed.Has("withscores")
 	params := map[string][]byte{
-		"tb":  args[1],
-		"min": []byte(min),
-		"max": []byte(max),
-	}
-	preprocessWithscores := func() *Result {
-		params["noval"] = []byte("false")
-		withscores = true
-		return nil
-	}
-	preprocessLimit := func(pos int) *Result {
-		_, err1 := strconv.ParseInt(utils.BytesToString(args[pos+1]), 10, 64)
-		_, err2 := strconv.ParseInt(utils.BytesToString(args[pos+2]), 10, 64)
-		if err1 != nil || err2 != nil {
-			result.status = errStatus
-			result.data = []byte("ERR value is not an integer or out of range")
-			return result
-		}
-		params["offset"] = args[pos+1]
-		params["size"] = args[pos+2]
-
-		return nil
+		"tb":    args[1],
+		"min":   []byte(min),
+		"max":   []byte(max),
+		"noval": []byte(strconv.FormatBool(!withscores)),
 	}
-
-	for i := 4; i < argc; i++ {
-		arg := bytes.ToLower(args[i])
-		if bytes.Compare(arg, []byte("withscores")) == 0 {
-			if result := preprocessWithscores(); result != nil {
-				return result
-			}
-		} else if bytes.Compare(arg, []byte("limit")) == 0 {
-			//At least limit have two arguments
-			if i >= argc-2 {
-				return &Result{
-					status: errStatus,
-					data:   []byte("ERR syntax error"),
-				}
-			} else {
-				if result := preprocessLimit(i); result != nil {
-					return result
-				}
-				i += 2
-			}
-		} else {
-			return &Result{
-				status: errStatus,
-				data:   []byte("ERR syntax error"),
-			}
-		}
+	if pos := parsed.Option("limit"); pos > 0 {
+		params["offset"] = []byte(strconv.FormatInt(parsed.Int(pos+1), 10))
+		params["size"] = []byte(strconv.FormatInt(parsed.Int(pos+2), 10))
 	}
-
-	resp := IDBHandle.HustdbZrangebyscore(params)
+	resp := hdb.HustdbZrangebyscore(params)
 	if resp.Code == 200 {
 		json.Unmarshal(resp.Data, &resArray)
 	}
-	if withscores {
-		result.array = make([]string, 0, 2*len(resArray))
-	} else {
-		result.array = make([]string, 0, len(resArray))
-	}
-	for _, item := range resArray {
-		key := item["key"].(string)
-		b, err := base64.StdEncoding.DecodeString(key)
-		if err != nil {
-			continue
-		}
-		result.array = append(result.array, utils.BytesToString(b))
-		if withscores {
-			result.array = append(result.array, item["val"].(string))
-		}
-	}
-	return result
+	return zrangeResult(resArray, withscores)
 }
 
-func zremHandle(args [][]byte) *Result {
+func zremHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	var remCnt int
 	argc := len(args[2:])
 	ch := make(chan int, argc)
@@ -722,7 +760,7 @@ func zremHandle(args [][]byte) *Result {
 			"key": key,
 		}
 		go func(params map[string][]byte) {
-			resp := IDBHandle.HustdbZrem(params)
+			resp := hdb.HustdbZrem(params)
 			ch <- resp.Code
 		}(params)
 	}
@@ -737,15 +775,15 @@ func zremHandle(args [][]byte) *Result {
 	}
 }
 
-func zscoreHandle(args [][]byte) *Result {
+func zscoreHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	params := map[string][]byte{
 		"tb":  args[1],
 		"key": args[2],
 	}
-	resp := IDBHandle.HustdbZscore(params)
+	resp := hdb.HustdbZscore(params)
 	if resp.Code == 200 {
 		return &Result{
-			status: successStatus,
+			status: bulkStatus,
 			data:   resp.Data,
 		}
 	} else {
@@ -755,37 +793,30 @@ func zscoreHandle(args [][]byte) *Result {
 	}
 }
 
-func zincrbyHandle(args [][]byte) *Result {
+func zincrbyHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	result := &Result{}
-	opt := "1"
-	if bytes.IndexByte(args[2], '-') == 0 {
-		args[2] = args[2][1:]
-		opt = "-1"
-	}
-	_, err := strconv.ParseFloat(utils.BytesToString(args[2]), 64)
-	if err != nil {
-		result.status = errStatus
-		result.data = []byte("ERR hash value is not an double")
-		return result
+	incr, opt := parsed.Float(2), "1"
+	if incr < 0 {
+		incr, opt = -incr, "-1"
 	}
 	params := map[string][]byte{
 		"tb":    args[1],
-		"score": args[2],
+		"score": []byte(strconv.FormatFloat(incr, 'f', -1, 64)),
 		"key":   args[3],
 		"opt":   []byte(opt),
 	}
-	resp := IDBHandle.HustdbZadd(params)
+	resp := hdb.HustdbZadd(params)
 	if resp.Code == 200 {
-		result.status = successStatus
+		result.status = bulkStatus
 		result.data = resp.Data
 	} else {
-		result.status = successStatus
+		result.status = bulkStatus
 		result.data = []byte("0")
 	}
 	return result
 }
 
-func zcardHandle(args [][]byte) *Result {
+func zcardHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
 	result := &Result{
 		status:  integerStatus,
 		integer: 0,
@@ -793,7 +824,7 @@ func zcardHandle(args [][]byte) *Result {
 	params := map[string][]byte{
 		"tb": args[1],
 	}
-	resp := IDBHandle.HustdbStat(params)
+	resp := hdb.HustdbStat(params)
 	if resp.Code == 200 {
 		sortedsetSize, err := strconv.Atoi(string(resp.Data))
 		if err == nil {
@@ -805,71 +836,35 @@ func zcardHandle(args [][]byte) *Result {
 	return result
 }
 
-/*
-func rpushHandle(args [][]byte) *Result {
-	result := &Result{}
-	params := map[string][]byte{
-		"queue": args[1],
-	}
-	for i := 2; i < len(args); i++ {
-		params["item"] = args[i]
-		IDBHandle.HustmqPut(params)
-	}
-	return result
-}
-
-func lpopHandle(args [][]byte) *Result {
-	result := &Result{}
-	params := map[string][]byte{
-		"queue":  args[1],
-		"worker": []byte("worker"),
-	}
-	resp := IDBHandle.HustmqGet(params)
-	if resp.Code == 200 {
-		result.status = successStatus
-		result.data = resp.Data
-	} else {
-		result.status = nilStatus
+func echoHandle(hdb *db.HustdbHandler, args [][]byte, parsed *Args) *Result {
+	return &Result{
+		status: bulkStatus,
+		data:   args[1],
 	}
-	return result
 }
 
-func llenHandle(args [][]byte) *Result {
-	result := &Result{
-		status:  integerStatus,
-		integer: 0,
-	}
-
-	mqInfo := map[string]interface{}{}
-	params := map[string][]byte{
-		"queue": args[1],
+// pingHandle answers PONG, or the message when one is given. While the
+// connection is subscribed the reply is a ["pong", message] array instead.
+func pingHandle(cc *clientConn, args [][]byte) *Result {
+	var msg []byte
+	if len(args) == 2 {
+		msg = args[1]
 	}
-	resp := IDBHandle.HustmqStat(params)
-	if resp.Code == 200 {
-		if err := json.Unmarshal(resp.Data, &mqInfo); err == nil {
-			if _, ok := mqInfo["ready"]; ok {
-				if ready, ok := mqInfo["ready"].([]interface{}); ok {
-					for i := 0; i < len(ready); i++ {
-						if val, ok := ready[i].(float64); ok {
-							result.integer += int(val)
-						}
-					}
-				}
-			}
+	if cc.subscriptions() > 0 {
+		return &Result{
+			status: arrayStatus,
+			array: []*Result{
+				{status: bulkStatus, data: []byte("pong")},
+				{status: bulkStatus, data: msg},
+			},
 		}
 	}
-	return result
-}
-*/
-
-func echoHandle(args [][]byte) *Result {
-	return &Result{
-		status: successStatus,
-		data:   args[1],
+	if msg != nil {
+		return &Result{
+			status: bulkStatus,
+			data:   msg,
+		}
 	}
-}
-
-func pingHandle(args [][]byte) *Result {
 	return &Result{
 		status: successStatus,
 		data:   []byte("PONG"),
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSetNXOneWinner(t *testing.T) {
+	hustdb := &fakeHustdb{versions: map[string]int{}}
+	startHustdb(t, hustdb)
+	for round := 0; round < 5; round++ {
+		key := "lock" + string(rune('0'+round))
+		var wg sync.WaitGroup
+		results := make([]*Result, 50)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = CmdMap["set"].handle(newTestConn(), cmdArgs("set", key, "owner", "nx"), nil)
+			}(i)
+		}
+		wg.Wait()
+		won := 0
+		for _, res := range results {
+			switch res.status {
+			case successStatus:
+				won++
+			case nilStatus:
+			default:
+				t.Fatalf("SET NX = %+v", res)
+			}
+		}
+		if won != 1 {
+			t.Errorf("%d of %d SET NX on %s won, want 1", won, len(results), key)
+		}
+	}
+}
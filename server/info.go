@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"../hustdb/binlog"
+	"../hustdb/peers"
+	"../internal/utils"
+)
+
+const (
+	Version = "1.0.0"
+
+	opsSamples = 16
+)
+
+var (
+	infoSections = []string{"server", "clients", "stats", "backends", "binlog", "memory"}
+	// all and everything add the sections listing every command
+	allInfoSections = append(infoSections, "commandstats", "latencystats")
+)
+
+// Stats holds the server wide counters. commands and connections are updated
+// atomically, the ops samples under Server.rwlock.
+type Stats struct {
+	commands    uint64
+	connections uint64
+	// connections refused because of maxclients
+	rejectedConnections uint64
+	// clients disconnected for breaking the protocol or its limits
+	protocolErrors uint64
+	// clients disconnected by the output buffer limits
+	outputLimitDisconnections uint64
+	// time spent waiting for a concurrency token
+	tokenWaitUsec  uint64
+	tokenWait      latencyHistogram
+	startTime      time.Time
+	opsSamples     [opsSamples]uint64
+	opsSampleIndex int
+}
+
+// sampleOps records commands per second once a second, INFO reports the
+// average of the last samples like redis' instantaneous_ops_per_sec.
+func (s *Server) sampleOps() {
+	last := atomic.LoadUint64(&s.stats.commands)
+	ticker := time.NewTicker(time.Second)
+	for range ticker.C {
+		cur := atomic.LoadUint64(&s.stats.commands)
+		s.rwlock.Lock()
+		s.stats.opsSamples[s.stats.opsSampleIndex%opsSamples] = cur - last
+		s.stats.opsSampleIndex++
+		s.rwlock.Unlock()
+		last = cur
+	}
+}
+
+func (s *Server) opsPerSec() uint64 {
+	s.rwlock.RLock()
+	defer s.rwlock.RUnlock()
+	var sum uint64
+	for _, n := range s.stats.opsSamples {
+		sum += n
+	}
+	return sum / opsSamples
+}
+
+func (s *Server) infoSection(buf *bytes.Buffer, section string) {
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(buf, format, args...)
+		buf.WriteString("\r\n")
+	}
+	switch section {
+	case "server":
+		uptime := time.Since(s.stats.startTime)
+		line("# Server")
+		line("goha_version:%s", Version)
+		line("go_version:%s", runtime.Version())
+		line("os:%s %s", runtime.GOOS, runtime.GOARCH)
+		line("process_id:%d", os.Getpid())
+		line("tcp_port:%d", s.port)
+		line("tls_port:%d", s.tlsPort)
+		line("unix_socket:%s", s.unixSocket)
+		line("uptime_in_seconds:%d", int64(uptime/time.Second))
+		line("uptime_in_days:%d", int64(uptime/(24*time.Hour)))
+	case "clients":
+		line("# Clients")
+		line("connected_clients:%d", s.ConnectionCount())
+		line("maxclients:%d", s.clientLimits().maxClients)
+	case "stats":
+		line("# Stats")
+		line("total_connections_received:%d", atomic.LoadUint64(&s.stats.connections))
+		line("rejected_connections:%d", atomic.LoadUint64(&s.stats.rejectedConnections))
+		line("protocol_errors:%d", atomic.LoadUint64(&s.stats.protocolErrors))
+		line("client_output_buffer_limit_disconnections:%d", atomic.LoadUint64(&s.stats.outputLimitDisconnections))
+		line("total_commands_processed:%d", atomic.LoadUint64(&s.stats.commands))
+		line("instantaneous_ops_per_sec:%d", s.opsPerSec())
+		limiter := s.limiter()
+		line("concurrency_limit:%d", limiter.Count())
+		line("concurrency_in_use:%d", limiter.InUse())
+	case "backends":
+		line("# Backends")
+		regions := peers.Snapshot()
+		hosts, alive := map[string]bool{}, map[string]bool{}
+		for idx, peer := range regions {
+			master, slave := peer.Backends.Master, peer.Backends.Slave
+			line("region%d:range=%d-%d,master=%s,master_alive=%d,slave=%s,slave_alive=%d",
+				idx, peer.Region[0], peer.Region[1],
+				master.Host, boolToInt(master.Alive), slave.Host, boolToInt(slave.Alive))
+			for _, b := range []peers.BackendDetail{master, slave} {
+				hosts[b.Host] = true
+				if b.Alive {
+					alive[b.Host] = true
+				}
+			}
+		}
+		line("backends:%d", len(hosts))
+		line("backends_alive:%d", len(alive))
+	case "binlog":
+		line("# Binlog")
+		var total int
+		for idx, depth := range binlog.QueueDepth() {
+			line("routine%d:queue_depth=%d", idx, depth)
+			total += depth
+		}
+		line("binlog_queue_depth:%d", total)
+	case "memory":
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		line("# Memory")
+		line("used_memory:%d", mem.HeapAlloc)
+		line("used_memory_sys:%d", mem.Sys)
+		line("heap_objects:%d", mem.HeapObjects)
+		line("total_alloc:%d", mem.TotalAlloc)
+		line("num_gc:%d", mem.NumGC)
+		line("goroutines:%d", runtime.NumGoroutine())
+	case "commandstats":
+		line("# Commandstats")
+		s.commandStatsInfo(line)
+	case "latencystats":
+		line("# Latencystats")
+		s.latencyStatsInfo(line)
+	}
+}
+
+func infoHandle(cc *clientConn, args [][]byte) *Result {
+	sections := infoSections
+	if len(args) == 2 {
+		switch section := strings.ToLower(utils.BytesToString(args[1])); section {
+		case "default":
+		case "all", "everything":
+			sections = allInfoSections
+		default:
+			sections = []string{section}
+		}
+	}
+	var buf bytes.Buffer
+	for i, section := range sections {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		cc.server.infoSection(&buf, section)
+	}
+	return &Result{
+		status: bulkStatus,
+		data:   buf.Bytes(),
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
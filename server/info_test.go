@@ -0,0 +1,80 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+// infoHeaders returns the section headers of an INFO reply, failing on a
+// line not ended by CRLF.
+func infoHeaders(t *testing.T, info string) []string {
+	headers := []string{}
+	if info == "" {
+		return headers
+	}
+	if !strings.HasSuffix(info, "\r\n") {
+		t.Errorf("INFO does not end with CRLF: %q", info)
+	}
+	for _, line := range strings.SplitAfter(info, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\r\n") || strings.Count(line, "\n") != 1 || strings.Count(line, "\r") != 1 {
+			t.Errorf("INFO line %q is not ended by a single CRLF", line)
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "# "):
+			headers = append(headers, line[2:])
+		case line == "":
+			// between sections only
+			if len(headers) == 0 {
+				t.Errorf("INFO starts with an empty line")
+			}
+		case !strings.Contains(line, ":"):
+			t.Errorf("INFO line %q is neither a header nor a field", line)
+		}
+	}
+	return headers
+}
+
+func TestInfoSections(t *testing.T) {
+	initBinlog()
+	loadRegions(t, "127.0.0.1:8085")
+	cc := newTestConn()
+	cc.server.clients = map[uint32]*clientConn{}
+	defaults := "Server Clients Stats Backends Binlog Memory"
+	tests := []struct {
+		args    []string
+		headers string
+	}{
+		{[]string{"info"}, defaults},
+		{[]string{"info", "default"}, defaults},
+		{[]string{"info", "clients"}, "Clients"},
+		{[]string{"info", "CLIENTS"}, "Clients"},
+		{[]string{"info", "backends"}, "Backends"},
+		{[]string{"info", "commandstats"}, "Commandstats"},
+		{[]string{"info", "all"}, defaults + " Commandstats Latencystats"},
+		{[]string{"info", "everything"}, defaults + " Commandstats Latencystats"},
+		{[]string{"info", "nosuchsection"}, ""},
+	}
+	for _, tt := range tests {
+		res := infoHandle(cc, cmdArgs(tt.args...))
+		if res.status != bulkStatus {
+			t.Errorf("%v = %v %q", tt.args, res.status, res.data)
+			continue
+		}
+		if got := strings.Join(infoHeaders(t, string(res.data)), " "); got != tt.headers {
+			t.Errorf("%v sections = %q, want %q", tt.args, got, tt.headers)
+		}
+	}
+
+	res := infoHandle(cc, cmdArgs("info", "clients"))
+	if !strings.Contains(string(res.data), "\r\nconnected_clients:0\r\n") {
+		t.Errorf("INFO clients = %q", res.data)
+	}
+	res = infoHandle(cc, cmdArgs("info", "backends"))
+	if !strings.Contains(string(res.data), "\r\nbackends:") {
+		t.Errorf("INFO backends = %q", res.data)
+	}
+}
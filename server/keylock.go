@@ -0,0 +1,67 @@
+package server
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// KeyLocker serializes operations on the same key inside the proxy. Keys are
+// spread over a fixed number of mutexes, so unrelated keys rarely contend.
+// Each slot also counts the writes done under its lock, which is how WATCH
+// notices writes to hashes, sets and sorted sets: hustdb only versions their
+// members, never the whole key.
+type KeyLocker struct {
+	locks  []sync.Mutex
+	writes []uint64
+}
+
+func NewKeyLocker(count int) *KeyLocker {
+	return &KeyLocker{
+		locks:  make([]sync.Mutex, count),
+		writes: make([]uint64, count),
+	}
+}
+
+func (kl *KeyLocker) slot(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(kl.locks)))
+}
+
+func (kl *KeyLocker) slots(keys [][]byte) []int {
+	seen := make(map[int]bool, len(keys))
+	slots := make([]int, 0, len(keys))
+	for _, key := range keys {
+		if slot := kl.slot(key); !seen[slot] {
+			seen[slot] = true
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// LockKeys locks the keys read and written, in slot order so that callers
+// locking overlapping keys can not deadlock. The returned func unlocks them
+// and counts a write on the slots of written.
+func (kl *KeyLocker) LockKeys(read, written [][]byte) func() {
+	slots := kl.slots(append(append([][]byte{}, read...), written...))
+	sort.Ints(slots)
+	for _, slot := range slots {
+		kl.locks[slot].Lock()
+	}
+	return func() {
+		for _, slot := range kl.slots(written) {
+			atomic.AddUint64(&kl.writes[slot], 1)
+		}
+		for i := len(slots) - 1; i >= 0; i-- {
+			kl.locks[slots[i]].Unlock()
+		}
+	}
+}
+
+// Writes returns the number of writes counted on the key's slot.
+func (kl *KeyLocker) Writes(key []byte) uint64 {
+	return atomic.LoadUint64(&kl.writes[kl.slot(key)])
+}
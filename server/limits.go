@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	def "../internal/defines"
+)
+
+const (
+	errMaxClients = "-ERR max number of clients reached\r\n"
+)
+
+type clientLimits struct {
+	maxClients int
+	timeout    time.Duration
+	keepAlive  time.Duration
+	noDelay    bool
+	proto      readerLimits
+
+	output         outputLimit
+	pubsubOutput   outputLimit
+	flushThreshold int
+}
+
+// SetClientLimits applies the client section of the configuration, new
+// values are seen by the next accepted connection and the next read.
+func (s *Server) SetClientLimits(conf *def.ServerConf) {
+	limits := clientLimits{
+		maxClients: conf.MaxClients,
+		timeout:    time.Duration(conf.Timeout) * time.Second,
+		keepAlive:  time.Duration(conf.TcpKeepAlive) * time.Second,
+		noDelay:    conf.TcpNoDelay == nil || *conf.TcpNoDelay,
+		proto: readerLimits{
+			maxBulkLen:      orDefault(conf.ProtoMaxBulkLen, defaultMaxBulkLen),
+			maxMultiBulkLen: orDefault(conf.MaxMultiBulkLen, defaultMaxMultiBulkLen),
+			maxQueryBuf:     orDefault(conf.ClientQueryBufferLimit, defaultMaxQueryBuf),
+		},
+		output:         newOutputLimit(&conf.OutputBufferLimit),
+		pubsubOutput:   newOutputLimit(&conf.PubSubOutputBufferLimit),
+		flushThreshold: orDefault(conf.OutputFlushThreshold, defaultFlushThreshold),
+	}
+	s.rwlock.Lock()
+	s.limits = limits
+	s.rwlock.Unlock()
+}
+
+func (s *Server) clientLimits() clientLimits {
+	s.rwlock.RLock()
+	defer s.rwlock.RUnlock()
+	return s.limits
+}
+
+// tuneConn sets the socket options of an accepted connection.
+func tuneConn(conn net.Conn, limits clientLimits) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if limits.keepAlive > 0 {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(limits.keepAlive)
+	} else {
+		tcpConn.SetKeepAlive(false)
+	}
+	tcpConn.SetNoDelay(limits.noDelay)
+}
+
+// setIdleDeadline arms the idle timeout before waiting for the next
+// command. Subscribers and monitors only listen, so like in redis they never
+// time out.
+func (cc *clientConn) setIdleDeadline(timeout time.Duration) {
+	if timeout > 0 && !cc.pushMode() {
+		cc.conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		cc.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+func orDefault(n, def int) int {
+	if n <= 0 {
+		return def
+	}
+	return n
+}
+
+func newOutputLimit(conf *def.OutputBufferLimit) outputLimit {
+	return outputLimit{
+		hard:   conf.Hard,
+		soft:   conf.Soft,
+		window: time.Duration(conf.SoftSeconds) * time.Second,
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	def "../internal/defines"
+)
+
+// ping sends PING and checks the server answers.
+func ping(t *testing.T, conn net.Conn, rd *bufio.Reader) {
+	io.WriteString(conn, "*1\r\n$4\r\nping\r\n")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if line, err := rd.ReadString('\n'); err != nil || line != "+PONG\r\n" {
+		t.Fatalf("PING = %q, %v", line, err)
+	}
+}
+
+func TestMaxClients(t *testing.T) {
+	s := startServer(t, &def.ServerConf{MaxClients: 2})
+	first := dialServer(t, s)
+	ping(t, first, bufio.NewReader(first))
+	second := dialServer(t, s)
+	ping(t, second, bufio.NewReader(second))
+
+	third := dialServer(t, s)
+	third.SetReadDeadline(time.Now().Add(time.Second))
+	rd := bufio.NewReader(third)
+	if line, err := rd.ReadString('\n'); err != nil || line != errMaxClients {
+		t.Errorf("third client got %q, %v, want %q", line, err, errMaxClients)
+	}
+	if _, err := rd.ReadByte(); err != io.EOF {
+		t.Errorf("third client still open: %v", err)
+	}
+	if n := atomic.LoadUint64(&s.stats.rejectedConnections); n != 1 {
+		t.Errorf("rejected_connections = %d, want 1", n)
+	}
+
+	// a slot frees once a client leaves
+	first.Close()
+	for start := time.Now(); s.ConnectionCount() > 1; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("%d clients after one left", s.ConnectionCount())
+		}
+	}
+	fourth := dialServer(t, s)
+	ping(t, fourth, bufio.NewReader(fourth))
+}
+
+func TestIdleTimeout(t *testing.T) {
+	s := startServer(t, &def.ServerConf{Timeout: 1})
+	idle := dialServer(t, s)
+	idleRd := bufio.NewReader(idle)
+	ping(t, idle, idleRd)
+	// subscribers only listen and never time out
+	sub := dialServer(t, s)
+	subRd := bufio.NewReader(sub)
+	io.WriteString(sub, "*2\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n")
+	sub.SetReadDeadline(time.Now().Add(time.Second))
+	want := subReply("subscribe", "news", 1)
+	reply := make([]byte, len(want))
+	if _, err := io.ReadFull(subRd, reply); err != nil || string(reply) != want {
+		t.Fatalf("SUBSCRIBE = %q, %v", reply, err)
+	}
+
+	start := time.Now()
+	idle.SetReadDeadline(start.Add(3 * time.Second))
+	if _, err := idleRd.ReadByte(); err != io.EOF {
+		t.Fatalf("idle client: %v, want it closed", err)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("idle client closed after %v, want about 1s", elapsed)
+	}
+
+	sub.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := subRd.ReadByte(); err == io.EOF {
+		t.Error("subscriber closed by the idle timeout")
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	def "../internal/defines"
+
+	"github.com/cihub/seelog"
+)
+
+// listen opens every listener the configuration asks for: Port and Tls.Port
+// on each Bind address, all interfaces when there is none, UnixSocket and
+// MetricsAddr.
+func (s *Server) listen(conf *def.ServerConf) error {
+	if conf.Port == 0 && conf.Tls.Port == 0 && conf.UnixSocket == "" {
+		return errors.New("none of Port, Tls.Port and UnixSocket is set")
+	}
+	binds := conf.Bind
+	if len(binds) == 0 {
+		binds = []string{""}
+	}
+	if conf.Tls.Port != 0 {
+		var err error
+		if s.certs, err = newCertStore(&conf.Tls); err != nil {
+			return err
+		}
+	}
+	for _, bind := range binds {
+		if conf.Port != 0 {
+			if err := s.addListener(net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(conf.Port)))); err != nil {
+				return err
+			}
+		}
+		if conf.Tls.Port != 0 {
+			addr := net.JoinHostPort(bind, strconv.Itoa(conf.Tls.Port))
+			if err := s.addListener(tls.Listen("tcp", addr, s.certs.listenerConfig())); err != nil {
+				return err
+			}
+		}
+	}
+	if conf.MetricsAddr != "" {
+		listener, err := net.Listen("tcp", conf.MetricsAddr)
+		if err != nil {
+			return err
+		}
+		seelog.Infof("serving metrics on %s", listener.Addr())
+		s.metricsListener = listener
+		s.metricsServer = s.newMetricsServer()
+	}
+	if conf.UnixSocket != "" {
+		return s.listenUnix(conf.UnixSocket, conf.UnixSocketPerm)
+	}
+	return nil
+}
+
+func (s *Server) listenUnix(path, perm string) error {
+	mode := os.FileMode(0700)
+	if perm != "" {
+		n, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil {
+			return errors.New("bad UnixSocketPerm " + perm)
+		}
+		mode = os.FileMode(n)
+	}
+	// a socket left behind by a process that did not exit cleanly, anything
+	// else at the path is not ours to remove
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return errors.New("UnixSocket " + path + " exists and is not a socket")
+		}
+		os.Remove(path)
+	}
+	// the umask gives the socket its mode as it is created, so it is never
+	// reachable with wider permissions
+	old := syscall.Umask(int(^mode & os.ModePerm))
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(old)
+	return s.addListener(listener, err)
+}
+
+func (s *Server) addListener(listener net.Listener, err error) error {
+	if err != nil {
+		return err
+	}
+	seelog.Infof("listening on %s %s", listener.Addr().Network(), listener.Addr())
+	s.rwlock.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.rwlock.Unlock()
+	return nil
+}
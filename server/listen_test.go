@@ -0,0 +1,45 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "goha.sock")
+	for _, perm := range []string{"", "770"} {
+		s := newTestServer(1)
+		if err := s.listenUnix(path, perm); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := os.FileMode(0700)
+		if perm != "" {
+			want = 0770
+		}
+		if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != want {
+			t.Errorf("UnixSocketPerm %q: socket mode %v, want %v", perm, fi.Mode(), want)
+		}
+		// the socket stays behind, as after a crash, for the next round
+		s.listeners[0].(*net.UnixListener).SetUnlinkOnClose(false)
+		s.Close()
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := newTestServer(1).listenUnix(file, ""); err == nil {
+		t.Error("listenUnix replaced a regular file")
+	}
+	if data, err := ioutil.ReadFile(file); err != nil || string(data) != "data" {
+		t.Errorf("regular file at UnixSocket is now %q, %v", data, err)
+	}
+}
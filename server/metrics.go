@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"../hustdb/binlog"
+	hc "../hustdb/healthcheck"
+	"../hustdb/peers"
+	"../internal/httpman"
+
+	"github.com/cihub/seelog"
+)
+
+const (
+	// a scraper gets this long to send its request and to read the reply
+	metricsReadTimeout  = 10 * time.Second
+	metricsWriteTimeout = 30 * time.Second
+)
+
+func (s *Server) newMetricsServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.metricsHandle)
+	return &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadTimeout,
+		ReadTimeout:       metricsReadTimeout,
+		WriteTimeout:      metricsWriteTimeout,
+		IdleTimeout:       metricsWriteTimeout,
+	}
+}
+
+// serveMetrics answers /metrics on the metrics listener until Close.
+func (s *Server) serveMetrics(srv *http.Server, listener net.Listener) {
+	if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+		seelog.Errorf("metrics listener stopped: %v", err)
+	}
+}
+
+func (s *Server) metricsHandle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	s.writeMetrics(&metricsWriter{out: out})
+	out.Flush()
+}
+
+// metricsWriter renders the prometheus text format.
+type metricsWriter struct {
+	out *bufio.Writer
+}
+
+func (m *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(m.out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value, labels alternating names and values.
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.out.WriteString(name)
+	if len(labels) > 0 {
+		m.out.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				m.out.WriteByte(',')
+			}
+			fmt.Fprintf(m.out, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		m.out.WriteByte('}')
+	}
+	m.out.WriteByte(' ')
+	m.out.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.out.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// histogram writes the cumulative buckets of a histogram, counts holding
+// one more bucket than bounds for the values above the last bound.
+func (m *metricsWriter) histogram(name string, bounds []float64, counts []uint64, sum float64, labels ...string) {
+	var total uint64
+	for idx, bound := range bounds {
+		total += counts[idx]
+		m.sample(name+"_bucket", float64(total), append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64))...)
+	}
+	total += counts[len(bounds)]
+	m.sample(name+"_bucket", float64(total), append(labels, "le", "+Inf")...)
+	m.sample(name+"_sum", sum, labels...)
+	m.sample(name+"_count", float64(total), labels...)
+}
+
+// promBuckets folds a latency histogram into the buckets of bounds, in
+// seconds. A fine bucket lands in the first bound covering all of it, so a
+// latency may be counted one bound late by up to the fine bucket's width.
+func promBuckets(h *latencyHistogram, bounds []float64) []uint64 {
+	counts := make([]uint64, len(bounds)+1)
+	bound := 0
+	for idx, n := range h.snapshot() {
+		upper := float64(histUpperBound(idx)) / 1e6
+		for bound < len(bounds) && upper > bounds[bound] {
+			bound++
+		}
+		counts[bound] += n
+	}
+	return counts
+}
+
+func (s *Server) writeMetrics(m *metricsWriter) {
+	bounds := httpman.LatencyBuckets
+
+	m.header("goha_commands_total", "counter", "Commands run, by command.")
+	for _, spec := range commandSpecs {
+		if calls := atomic.LoadUint64(&s.cmdStats[spec.name].calls); calls > 0 {
+			m.sample("goha_commands_total", float64(calls), "command", spec.name)
+		}
+	}
+	m.header("goha_commands_failed_total", "counter", "Commands that replied with an error, by command.")
+	for _, spec := range commandSpecs {
+		if failed := atomic.LoadUint64(&s.cmdStats[spec.name].failedCalls); failed > 0 {
+			m.sample("goha_commands_failed_total", float64(failed), "command", spec.name)
+		}
+	}
+	m.header("goha_commands_rejected_total", "counter", "Commands refused before running, by command.")
+	for _, spec := range commandSpecs {
+		if rejected := atomic.LoadUint64(&s.cmdStats[spec.name].rejectedCalls); rejected > 0 {
+			m.sample("goha_commands_rejected_total", float64(rejected), "command", spec.name)
+		}
+	}
+	m.header("goha_command_duration_seconds", "histogram", "Time spent running commands, by command.")
+	for _, spec := range commandSpecs {
+		stats := s.cmdStats[spec.name]
+		if atomic.LoadUint64(&stats.calls) == 0 {
+			continue
+		}
+		m.histogram("goha_command_duration_seconds", bounds, promBuckets(&stats.latency, bounds),
+			float64(atomic.LoadUint64(&stats.usec))/1e6, "command", spec.name)
+	}
+
+	m.header("goha_connected_clients", "gauge", "Clients connected.")
+	m.sample("goha_connected_clients", float64(s.ConnectionCount()))
+	m.header("goha_connections_received_total", "counter", "Connections accepted.")
+	m.sample("goha_connections_received_total", float64(atomic.LoadUint64(&s.stats.connections)))
+	m.header("goha_rejected_connections_total", "counter", "Connections refused because of MaxClients.")
+	m.sample("goha_rejected_connections_total", float64(atomic.LoadUint64(&s.stats.rejectedConnections)))
+
+	limiter := s.limiter()
+	m.header("goha_concurrency_limit", "gauge", "Commands allowed to run at once.")
+	m.sample("goha_concurrency_limit", float64(limiter.Count()))
+	m.header("goha_concurrency_in_use", "gauge", "Commands running.")
+	m.sample("goha_concurrency_in_use", float64(limiter.InUse()))
+	m.header("goha_token_wait_seconds", "histogram", "Time commands waited for a concurrency token.")
+	m.histogram("goha_token_wait_seconds", bounds, promBuckets(&s.stats.tokenWait, bounds),
+		float64(atomic.LoadUint64(&s.stats.tokenWaitUsec))/1e6)
+
+	backendStats := httpman.Stats()
+	m.header("goha_backend_requests_total", "counter", "HTTP requests answered by the backends, by backend and status code.")
+	for _, st := range backendStats {
+		codes := make([]int, 0, len(st.Codes))
+		for code := range st.Codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			m.sample("goha_backend_requests_total", float64(st.Codes[code]), "backend", st.Backend, "code", strconv.Itoa(code))
+		}
+	}
+	m.header("goha_backend_request_errors_total", "counter", "HTTP requests that got no response, by backend.")
+	for _, st := range backendStats {
+		m.sample("goha_backend_request_errors_total", float64(st.Errors), "backend", st.Backend)
+	}
+	m.header("goha_backend_request_duration_seconds", "histogram", "Latency of the HTTP requests, by backend.")
+	for _, st := range backendStats {
+		m.histogram("goha_backend_request_duration_seconds", httpman.LatencyBuckets, st.Buckets,
+			st.Elapsed.Seconds(), "backend", st.Backend)
+	}
+
+	alive := map[string]bool{}
+	for _, peer := range peers.Snapshot() {
+		for _, b := range []peers.BackendDetail{peer.Backends.Master, peer.Backends.Slave} {
+			alive[b.Host] = alive[b.Host] || b.Alive
+		}
+	}
+	hosts := make([]string, 0, len(alive))
+	for host := range alive {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	m.header("goha_backend_alive", "gauge", "Whether the backend passes its health checks.")
+	for _, host := range hosts {
+		m.sample("goha_backend_alive", float64(boolToInt(alive[host])), "backend", host)
+	}
+	failures := hc.Failures()
+	m.header("goha_healthcheck_failures_total", "counter", "Failed health checks, by backend.")
+	for _, host := range hosts {
+		m.sample("goha_healthcheck_failures_total", float64(failures[host]), "backend", host)
+	}
+
+	m.header("goha_binlog_queue_depth", "gauge", "Binlog tasks waiting, by routine.")
+	for idx, depth := range binlog.QueueDepth() {
+		m.sample("goha_binlog_queue_depth", float64(depth), "routine", strconv.Itoa(idx))
+	}
+	m.header("goha_binlog_failures_total", "counter", "Binlog tasks the backends refused.")
+	m.sample("goha_binlog_failures_total", float64(binlog.Failures()))
+}
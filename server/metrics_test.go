@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeMetrics returns the lines the metrics handler serves.
+func scrapeMetrics(t *testing.T, s *Server) []string {
+	rec := httptest.NewRecorder()
+	s.metricsHandle(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var lines []string
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines
+}
+
+func TestMetricsTypes(t *testing.T) {
+	loadRegions(t, "127.0.0.1:8085")
+	s := newTestServer(4)
+	s.recordCall("get", time.Millisecond, nil)
+	types := map[string]string{}
+	for _, line := range scrapeMetrics(t, s) {
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				t.Errorf("bad TYPE line %q", line)
+				continue
+			}
+			types[fields[2]] = fields[3]
+			continue
+		}
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		name := line[:strings.IndexAny(line, "{ ")]
+		kind, ok := types[name]
+		if !ok {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if base := strings.TrimSuffix(name, suffix); base != name {
+					name, kind, ok = base, types[base], types[base] == "histogram"
+					break
+				}
+			}
+		}
+		if !ok {
+			t.Errorf("sample %q comes before the TYPE of %s", line, name)
+		}
+		if kind == "counter" && !strings.HasSuffix(name, "_total") {
+			t.Errorf("counter %s does not end in _total", name)
+		}
+	}
+	want := map[string]string{
+		"goha_commands_total":                   "counter",
+		"goha_command_duration_seconds":         "histogram",
+		"goha_connected_clients":                "gauge",
+		"goha_concurrency_in_use":               "gauge",
+		"goha_token_wait_seconds":               "histogram",
+		"goha_backend_request_duration_seconds": "histogram",
+		"goha_backend_alive":                    "gauge",
+		"goha_binlog_failures_total":            "counter",
+	}
+	for name, kind := range want {
+		if types[name] != kind {
+			t.Errorf("TYPE of %s = %q, want %q", name, types[name], kind)
+		}
+	}
+}
+
+func TestMetricsHistogramBuckets(t *testing.T) {
+	loadRegions(t, "127.0.0.1:8085")
+	s := newTestServer(4)
+	latencies := []time.Duration{0, 50 * time.Microsecond, 3 * time.Millisecond, 40 * time.Millisecond, 2 * time.Second, time.Hour}
+	for _, latency := range latencies {
+		s.recordCall("get", latency, nil)
+	}
+	prefix := `goha_command_duration_seconds_bucket{command="get",le="`
+	var buckets []string
+	var counts []float64
+	count := -1.0
+	for _, line := range scrapeMetrics(t, s) {
+		if strings.HasPrefix(line, prefix) {
+			end := strings.Index(line, `"}`)
+			buckets = append(buckets, line[len(prefix):end])
+			value, _ := strconv.ParseFloat(line[end+3:], 64)
+			counts = append(counts, value)
+		}
+		if strings.HasPrefix(line, `goha_command_duration_seconds_count{command="get"} `) {
+			count, _ = strconv.ParseFloat(strings.Fields(line)[1], 64)
+		}
+	}
+	if len(buckets) < 2 || buckets[len(buckets)-1] != "+Inf" {
+		t.Fatalf("buckets %v do not end in +Inf", buckets)
+	}
+	prevBound := -1.0
+	for i := range counts {
+		if i > 0 && counts[i] < counts[i-1] {
+			t.Errorf("bucket le=%s holds %v, less than the one before", buckets[i], counts[i])
+		}
+		if i < len(buckets)-1 {
+			bound, err := strconv.ParseFloat(buckets[i], 64)
+			if err != nil || bound <= prevBound {
+				t.Errorf("bucket bound %q after %v", buckets[i], prevBound)
+			}
+			prevBound = bound
+		}
+	}
+	if last := counts[len(counts)-1]; last != count || count != float64(len(latencies)) {
+		t.Errorf("+Inf bucket %v, count %v, want %d", last, count, len(latencies))
+	}
+	if counts[len(counts)-2] == count {
+		t.Errorf("the hour long call is counted below le=%s", buckets[len(buckets)-2])
+	}
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	loadRegions(t, `bad"host\name`+"\nx")
+	want := `goha_backend_alive{backend="bad\"host\\name\nx"} 1`
+	for _, line := range scrapeMetrics(t, newTestServer(4)) {
+		if line == want {
+			return
+		}
+	}
+	t.Errorf("no line %q", want)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"../internal/utils"
+)
+
+// feedMonitors streams the command to the connections running MONITOR.
+// Callers check numMonitors first, so nobody pays for the formatting while
+// no one is watching.
+func (s *Server) feedMonitors(cc *clientConn, args [][]byte) {
+	line := monitorLine(time.Now(), cc.conn.RemoteAddr().String(), args)
+	s.monitorLock.RLock()
+	defer s.monitorLock.RUnlock()
+	for monitor := range s.monitors {
+		monitor.push(&Result{status: successStatus, data: line})
+	}
+}
+
+func (s *Server) monitoring() bool {
+	return atomic.LoadInt32(&s.numMonitors) > 0
+}
+
+func (s *Server) addMonitor(cc *clientConn) {
+	s.monitorLock.Lock()
+	s.monitors[cc] = true
+	atomic.StoreInt32(&s.numMonitors, int32(len(s.monitors)))
+	s.monitorLock.Unlock()
+}
+
+func (s *Server) removeMonitor(cc *clientConn) {
+	s.monitorLock.Lock()
+	delete(s.monitors, cc)
+	atomic.StoreInt32(&s.numMonitors, int32(len(s.monitors)))
+	s.monitorLock.Unlock()
+}
+
+// redactedArg replaces the arguments redactFrom hides.
+const redactedArg = "(redacted)"
+
+// redactFrom returns the index of the first argument that may hold a
+// password, len(args) when none does. MONITOR and SLOWLOG show the
+// arguments from there on as (redacted).
+func redactFrom(args [][]byte) int {
+	name := utils.BytesToString(args[0])
+	switch {
+	case strings.EqualFold(name, "auth"):
+		return 1
+	case strings.EqualFold(name, "acl"):
+		if len(args) > 1 && strings.EqualFold(utils.BytesToString(args[1]), "setuser") {
+			return 3
+		}
+	}
+	return len(args)
+}
+
+// monitorLine renders the command the way redis does, e.g.
+// 1339518083.107412 [0 127.0.0.1:60866] "set" "key" "value". Passwords are
+// replaced by (redacted).
+func monitorLine(now time.Time, addr string, args [][]byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d.%06d [0 %s]", now.Unix(), now.Nanosecond()/1000, addr)
+	redactFrom := redactFrom(args)
+	for i, arg := range args {
+		buf.WriteByte(' ')
+		if i >= redactFrom {
+			buf.WriteString(`"` + redactedArg + `"`)
+			continue
+		}
+		writeRepr(&buf, arg)
+	}
+	return buf.Bytes()
+}
+
+// writeRepr quotes the argument like redis' sdscatrepr.
+func writeRepr(buf *bytes.Buffer, arg []byte) {
+	buf.WriteByte('"')
+	for _, c := range arg {
+		switch c {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(buf, `\x%02x`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// monitorHandle turns the connection into a stream of every command the
+// proxy runs. Like a subscriber it can only QUIT afterwards.
+func monitorHandle(cc *clientConn, args [][]byte) *Result {
+	if !cc.monitor {
+		// set before the push goroutine starts, which reads it
+		cc.monitor = true
+		cc.startPush()
+		cc.info.lock.Lock()
+		cc.info.monitor = true
+		cc.info.lock.Unlock()
+		cc.server.addMonitor(cc)
+	}
+	return &Result{
+		status: successStatus,
+		data:   []byte("OK"),
+	}
+}
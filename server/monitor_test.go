@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// addrConn is a bufConn with a remote address for the monitor lines.
+type addrConn struct {
+	bufConn
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6379}
+}
+
+// monitoredConn returns a logged in connection and the stream of the
+// commands MONITOR shows.
+func monitoredConn(t *testing.T) (*clientConn, chan *Result) {
+	s := newTestServer(8)
+	var err error
+	if s.acl, err = NewACL("", ""); err != nil {
+		t.Fatal(err)
+	}
+	monitor := &clientConn{pushCh: make(chan *Result, 16)}
+	s.monitors = map[*clientConn]bool{monitor: true}
+	s.numMonitors = 1
+	conn := &addrConn{}
+	cc := &clientConn{server: s, conn: conn, wr: NewWriter(conn), user: defaultUser}
+	return cc, monitor.pushCh
+}
+
+func monitoredNames(ch chan *Result) []string {
+	var names []string
+	for len(ch) > 0 {
+		line := string((<-ch).data)
+		// 1339518083.107412 [0 127.0.0.1:60866] "set" "key" "value"
+		fields := strings.Fields(line[strings.Index(line, "]")+1:])
+		names = append(names, strings.Trim(fields[0], `"`))
+	}
+	return names
+}
+
+func TestMonitorTransactions(t *testing.T) {
+	startHustdb(t, &fakeHustdb{versions: map[string]int{}})
+	tests := []struct {
+		cmds []string
+		want []string
+	}{
+		{[]string{"multi", "set", "get", "exec"}, []string{"multi", "set", "get", "exec"}},
+		{[]string{"multi", "set", "discard"}, []string{"multi", "discard"}},
+		{[]string{"multi", "set", "nosuchcommand", "exec"}, []string{"multi", "exec"}},
+		{[]string{"set", "get"}, []string{"set", "get"}},
+	}
+	for _, tt := range tests {
+		cc, ch := monitoredConn(t)
+		for _, name := range tt.cmds {
+			args := cmdArgs(name)
+			switch name {
+			case "set":
+				args = cmdArgs("set", "key", "val")
+			case "get":
+				args = cmdArgs("get", "key")
+			}
+			cc.dispatch(Command{Args: args})
+		}
+		if got := monitoredNames(ch); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%v: MONITOR showed %v, want %v", tt.cmds, got, tt.want)
+		}
+	}
+}
+
+func TestMonitorInsideMulti(t *testing.T) {
+	startHustdb(t, &fakeHustdb{versions: map[string]int{}})
+	cc, ch := monitoredConn(t)
+	conn := cc.conn.(*addrConn)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"multi"}, "+OK\r\n"},
+		{[]string{"monitor"}, "-ERR Command not allowed inside a transaction\r\n"},
+		{[]string{"set", "key", "val"}, "+QUEUED\r\n"},
+		{[]string{"exec"}, "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+	}
+	for _, tt := range tests {
+		cc.dispatch(Command{Args: cmdArgs(tt.args...)})
+		cc.wr.Flush()
+		if got := conn.out.String(); got != tt.want {
+			t.Errorf("%v = %q, want %q", tt.args, got, tt.want)
+		}
+		conn.out.Reset()
+	}
+	if cc.monitor || cc.multi {
+		t.Errorf("after EXEC monitor is %v, multi %v", cc.monitor, cc.multi)
+	}
+	if got := monitoredNames(ch); strings.Join(got, " ") != "multi exec" {
+		t.Errorf("MONITOR showed %v", got)
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"time"
+)
+
+var (
+	// commands run right away instead of being queued inside MULTI
+	multiCtrlCmds = map[string]bool{
+		"multi":   true,
+		"exec":    true,
+		"discard": true,
+		"watch":   true,
+		"quit":    true,
+	}
+)
+
+// watchedKey is what WATCH saw of a key: the hustdb version, which catches
+// every write to a string, and the writes KeyLock counted on its slot, which
+// catch the writes through this proxy to the other types too. hustdb has no
+// version for a whole hash, set or sorted set, so writes to those from
+// another proxy or straight to hustdb go unnoticed, and a write to another
+// key of the same slot aborts EXEC needlessly.
+type watchedKey struct {
+	version int
+	writes  uint64
+}
+
+func watchKey(cc *clientConn, key []byte) watchedKey {
+	// counting first, a write landing in between aborts EXEC needlessly
+	// rather than going unnoticed
+	writes := KeyLock.Writes(key)
+	return watchedKey{
+		version: keyVersion(IDBHandle.WithTrace(cc.trace), key),
+		writes:  writes,
+	}
+}
+
+type queuedCmd struct {
+	handler *CmdHandler
+	args    [][]byte
+}
+
+func (cc *clientConn) resetMulti() {
+	cc.multi = false
+	cc.multiDirty = false
+	cc.queued = nil
+	cc.watched = nil
+}
+
+func multiHandle(cc *clientConn, args [][]byte) *Result {
+	if cc.multi {
+		return &Result{
+			status: errStatus,
+			data:   []byte("ERR MULTI calls can not be nested"),
+		}
+	}
+	cc.multi = true
+	return &Result{
+		status: successStatus,
+		data:   []byte("OK"),
+	}
+}
+
+func discardHandle(cc *clientConn, args [][]byte) *Result {
+	if !cc.multi {
+		return &Result{
+			status: errStatus,
+			data:   []byte("ERR DISCARD without MULTI"),
+		}
+	}
+	cc.resetMulti()
+	return &Result{
+		status: successStatus,
+		data:   []byte("OK"),
+	}
+}
+
+// execHandle runs the queued commands one after another. There is no
+// atomicity across hustdb backends, but the watched keys and the keys the
+// queue writes stay locked from the version check to the last command, so no
+// other write through the proxy lands in between.
+func execHandle(cc *clientConn, args [][]byte) *Result {
+	if !cc.multi {
+		return &Result{
+			status: errStatus,
+			data:   []byte("ERR EXEC without MULTI"),
+		}
+	}
+	queued, dirty, watched := cc.queued, cc.multiDirty, cc.watched
+	cc.resetMulti()
+	if dirty {
+		return &Result{
+			status: errStatus,
+			data:   []byte("EXECABORT Transaction discarded because of previous errors."),
+		}
+	}
+	keys := make([][]byte, 0, len(watched))
+	for key := range watched {
+		keys = append(keys, []byte(key))
+	}
+	var written [][]byte
+	for _, cmd := range queued {
+		written = append(written, cmd.handler.writtenKeys(cmd.args)...)
+	}
+	defer KeyLock.LockKeys(keys, written)()
+	for _, key := range keys {
+		if watchKey(cc, key) != watched[string(key)] {
+			return &Result{
+				status: nilArrayStatus,
+			}
+		}
+	}
+	result := &Result{
+		status: arrayStatus,
+		array:  make([]*Result, 0, len(queued)),
+	}
+	for _, cmd := range queued {
+		if cc.server.monitoring() {
+			cc.server.feedMonitors(cc, cmd.args)
+		}
+		startTS := time.Now()
+		res := cmd.handler.run(cc, cmd.args, cc.trace)
+		cc.server.recordCall(cmd.handler.spec.name, time.Since(startTS), res)
+		result.array = append(result.array, res)
+	}
+	return result
+}
+
+// watchHandle remembers the current version of each key, EXEC compares them
+// again before running the queue.
+func watchHandle(cc *clientConn, args [][]byte) *Result {
+	if cc.multi {
+		return &Result{
+			status: errStatus,
+			data:   []byte("ERR WATCH inside MULTI is not allowed"),
+		}
+	}
+	if cc.watched == nil {
+		cc.watched = map[string]watchedKey{}
+	}
+	for _, key := range args[1:] {
+		if _, ok := cc.watched[string(key)]; !ok {
+			cc.watched[string(key)] = watchKey(cc, key)
+		}
+	}
+	return &Result{
+		status: successStatus,
+		data:   []byte("OK"),
+	}
+}
+
+func unwatchHandle(cc *clientConn, args [][]byte) *Result {
+	cc.watched = nil
+	return &Result{
+		status: successStatus,
+		data:   []byte("OK"),
+	}
+}
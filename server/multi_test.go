@@ -0,0 +1,190 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"../hustdb/peers"
+	def "../internal/defines"
+	"../internal/httpman"
+)
+
+// fakeHustdb keeps the versions and values of string keys, enough for get,
+// exist and put. Each request is atomic, nothing spans two of them.
+type fakeHustdb struct {
+	lock     sync.Mutex
+	versions map[string]int
+	// the values put, "val" for a key that only has a version
+	values map[string][]byte
+}
+
+func (f *fakeHustdb) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := r.URL.Query().Get("key")
+	switch r.URL.Path {
+	case "/hustdb/get":
+		ver, ok := f.versions[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Version", strconv.Itoa(ver))
+		if val, ok := f.values[key]; ok {
+			w.Write(val)
+		} else {
+			w.Write([]byte("val"))
+		}
+	case "/hustdb/exist":
+		if _, ok := f.versions[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case "/hustdb/put":
+		val, _ := ioutil.ReadAll(r.Body)
+		if f.values == nil {
+			f.values = map[string][]byte{}
+		}
+		f.values[key] = val
+		f.versions[key]++
+		w.Header().Set("Version", strconv.Itoa(f.versions[key]))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeHustdb) bump(key string) {
+	f.lock.Lock()
+	f.versions[key]++
+	f.lock.Unlock()
+}
+
+// startHustdb points every region at a server running handler.
+func startHustdb(t *testing.T, handler http.Handler) {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	httpman.InitHttp(def.HttpConf{MaxIdleConnsPerHost: 8, ResponseHeaderTimeout: 5, Timeout: 5}, 5)
+	loadRegions(t, ts.Listener.Addr().String())
+}
+
+// loadRegions makes host the master and the slave of every region.
+func loadRegions(t *testing.T, host string) {
+	path := filepath.Join(t.TempDir(), "backends.json")
+	table := fmt.Sprintf(`{"table": [{"item": {"key": [0, 1024], "val": [%q, %q]}}]}`, host, host)
+	if err := ioutil.WriteFile(path, []byte(table), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !peers.Init(path) {
+		t.Fatal("can not load", path)
+	}
+}
+
+func newTestConn() *clientConn {
+	return &clientConn{server: newTestServer(8)}
+}
+
+func cmdArgs(words ...string) [][]byte {
+	res := make([][]byte, len(words))
+	for i, word := range words {
+		res[i] = []byte(word)
+	}
+	return res
+}
+
+// runWatched watches key, lets change run, queues a command and returns
+// the reply of EXEC and whether the command ran.
+func runWatched(key string, change func()) (*Result, bool) {
+	cc := newTestConn()
+	watchHandle(cc, cmdArgs("watch", key))
+	change()
+	multiHandle(cc, cmdArgs("multi"))
+	ran := false
+	handler := testHandler(func(args [][]byte) *Result {
+		ran = true
+		return &Result{status: successStatus, data: []byte("OK")}
+	})
+	handler.spec = commandByName["set"]
+	cc.queued = append(cc.queued, queuedCmd{handler: handler, args: cmdArgs("set", key, "val")})
+	return execHandle(cc, cmdArgs("exec")), ran
+}
+
+func TestWatchExec(t *testing.T) {
+	hustdb := &fakeHustdb{versions: map[string]int{"str": 1}}
+	startHustdb(t, hustdb)
+	tests := []struct {
+		name    string
+		key     string
+		change  func()
+		aborted bool
+	}{
+		{"unchanged string", "str", func() {}, false},
+		{"unchanged hash", "hash", func() {}, false},
+		{"string written elsewhere", "str", func() { hustdb.bump("str") }, true},
+		{"string created elsewhere", "new", func() { hustdb.bump("new") }, true},
+		{"hash written through the proxy", "hash", func() { KeyLock.LockKeys(nil, cmdArgs("hash"))() }, true},
+		{"hash read through the proxy", "hash", func() { KeyLock.LockKeys(cmdArgs("hash"), nil)() }, false},
+	}
+	for _, tt := range tests {
+		res, ran := runWatched(tt.key, tt.change)
+		if tt.aborted {
+			if res.status != nilArrayStatus || ran {
+				t.Errorf("%s: EXEC = %+v, ran %v, want aborted", tt.name, res, ran)
+			}
+		} else if res.status != arrayStatus || len(res.array) != 1 || !ran {
+			t.Errorf("%s: EXEC = %+v, ran %v, want the queued reply", tt.name, res, ran)
+		}
+	}
+}
+
+func TestExecWithoutMulti(t *testing.T) {
+	cc := newTestConn()
+	if res := execHandle(cc, cmdArgs("exec")); res.status != errStatus {
+		t.Errorf("EXEC without MULTI = %+v", res)
+	}
+	multiHandle(cc, cmdArgs("multi"))
+	cc.multiDirty = true
+	if res := execHandle(cc, cmdArgs("exec")); res.status != errStatus || cc.multi {
+		t.Errorf("EXEC of a dirty transaction = %+v, multi %v", res, cc.multi)
+	}
+}
+
+func TestLockKeysOrder(t *testing.T) {
+	kl := NewKeyLocker(16)
+	keys := cmdArgs("a", "b", "c", "d", "e", "f", "g", "h")
+	reversed := make([][]byte, len(keys))
+	for i, key := range keys {
+		reversed[len(keys)-1-i] = key
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, order := range [][][]byte{keys, reversed} {
+		wg.Add(1)
+		go func(order [][]byte) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				// the same key both read and written locks its slot once
+				kl.LockKeys(order, order[:2])()
+			}
+		}(order)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("LockKeys deadlocked on keys locked in opposite orders")
+	}
+	for _, key := range [][]byte{keys[0], keys[1], keys[6], keys[7]} {
+		if kl.Writes(key) == 0 {
+			t.Errorf("no write counted on %s", key)
+		}
+	}
+}
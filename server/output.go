@@ -0,0 +1,106 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/cihub/seelog"
+)
+
+const (
+	// replies are written out once this much is buffered instead of after
+	// the whole pipeline
+	defaultFlushThreshold = 64 * 1024
+	// how long a write may take when neither the soft limit window nor the
+	// idle timeout is set
+	defaultWriteTimeout = 5 * time.Minute
+)
+
+var (
+	errOutputHardLimit = errors.New("output buffer hard limit reached")
+	errOutputSoftLimit = errors.New("output buffer soft limit exceeded for too long")
+	errOutputTimeout   = errors.New("replies not read in time")
+)
+
+// outputLimit works like redis' client-output-buffer-limit: a client is
+// disconnected as soon as its replies pass hard, or when they stay above
+// soft for longer than window. Zero disables a limit.
+type outputLimit struct {
+	hard   int
+	soft   int
+	window time.Duration
+}
+
+func (cc *clientConn) outputLimit(limits *clientLimits) outputLimit {
+	if cc.pushMode() {
+		return limits.pubsubOutput
+	}
+	return limits.output
+}
+
+// checkOutput is called with wrlock held after each reply is buffered. It
+// enforces the limits and flushes once the threshold is reached.
+func (cc *clientConn) checkOutput() error {
+	limits := cc.server.clientLimits()
+	limit := cc.outputLimit(&limits)
+	n := cc.wr.Buffered()
+	if limit.hard > 0 && n > limit.hard {
+		return cc.overLimit(errOutputHardLimit, n)
+	}
+	if limit.soft > 0 && n > limit.soft {
+		if cc.softSince.IsZero() {
+			cc.softSince = time.Now()
+		} else if limit.window > 0 && time.Since(cc.softSince) > limit.window {
+			return cc.overLimit(errOutputSoftLimit, n)
+		}
+	} else {
+		cc.softSince = time.Time{}
+	}
+	// above the soft limit the replies go out at once, so only a client
+	// that does not read can stay there
+	if n < limits.flushThreshold && cc.softSince.IsZero() {
+		return nil
+	}
+	return cc.flush()
+}
+
+// flush writes the buffered replies. Above the soft limit the write has to
+// finish within what is left of the window, below it within the window, or
+// the idle timeout when there is none. The buffer only holds what is not
+// flushed yet, so a client reading too slowly to ever fill it is caught by
+// its writes timing out, which counts as passing the limits.
+func (cc *clientConn) flush() error {
+	limits := cc.server.clientLimits()
+	window := cc.outputLimit(&limits).window
+	limitErr := errOutputTimeout
+	var deadline time.Time
+	switch {
+	case !cc.softSince.IsZero() && window > 0:
+		deadline = cc.softSince.Add(window)
+		limitErr = errOutputSoftLimit
+	case window > 0:
+		deadline = time.Now().Add(window)
+	case limits.timeout > 0:
+		deadline = time.Now().Add(limits.timeout)
+	default:
+		deadline = time.Now().Add(defaultWriteTimeout)
+	}
+	cc.conn.SetWriteDeadline(deadline)
+	if err := cc.wr.Flush(); err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return cc.overLimit(limitErr, cc.wr.Buffered())
+		}
+		return err
+	}
+	cc.softSince = time.Time{}
+	return nil
+}
+
+func (cc *clientConn) overLimit(err error, buffered int) error {
+	atomic.AddUint64(&cc.server.stats.outputLimitDisconnections, 1)
+	seelog.Warnf("closing client %d %v: %v (%d bytes)", cc.id, cc.conn.RemoteAddr(), err, buffered)
+	cc.wr.Reset()
+	return err
+}
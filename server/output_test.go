@@ -0,0 +1,127 @@
+package server
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	def "../internal/defines"
+)
+
+// stuckConn is a client that never reads: every write runs into its
+// deadline.
+type stuckConn struct {
+	addrConn
+	deadline time.Time
+}
+
+func (c *stuckConn) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *stuckConn) Write(b []byte) (int, error) {
+	return 0, os.ErrDeadlineExceeded
+}
+
+func newOutputConn(conn *stuckConn, limit outputLimit, threshold int) *clientConn {
+	s := newTestServer(1)
+	s.limits.output = limit
+	s.limits.flushThreshold = threshold
+	return &clientConn{server: s, conn: conn, wr: NewWriter(conn)}
+}
+
+func TestOutputHardLimit(t *testing.T) {
+	cc := newOutputConn(&stuckConn{}, outputLimit{hard: 100}, 1<<20)
+	cc.wr.WriteBulk(make([]byte, 90))
+	if err := cc.checkOutput(); err != nil {
+		t.Fatalf("checkOutput under the hard limit = %v", err)
+	}
+	cc.wr.WriteBulk(make([]byte, 10))
+	if err := cc.checkOutput(); err != errOutputHardLimit {
+		t.Fatalf("checkOutput over the hard limit = %v", err)
+	}
+	if cc.wr.Buffered() != 0 || cc.server.stats.outputLimitDisconnections != 1 {
+		t.Errorf("after the hard limit %d bytes buffered, %d disconnections",
+			cc.wr.Buffered(), cc.server.stats.outputLimitDisconnections)
+	}
+}
+
+func TestOutputSoftLimit(t *testing.T) {
+	conn := &stuckConn{}
+	cc := newOutputConn(conn, outputLimit{soft: 100, window: 2 * time.Second}, 1<<20)
+	cc.wr.WriteBulk(make([]byte, 200))
+	start := time.Now()
+	// the write blocks until the window runs out for a client not reading
+	if err := cc.checkOutput(); err != errOutputSoftLimit {
+		t.Fatalf("checkOutput over the soft limit = %v", err)
+	}
+	if d := conn.deadline.Sub(start); d < 2*time.Second || d > 2*time.Second+time.Second/10 {
+		t.Errorf("write deadline %v after passing the soft limit, want the 2s window", d)
+	}
+
+	// a client catching up in time drops back under the soft limit
+	cc = newOutputConn(&stuckConn{}, outputLimit{soft: 100, window: 2 * time.Second}, 1<<20)
+	cc.softSince = time.Now().Add(-time.Second)
+	cc.wr.WriteBulk(make([]byte, 10))
+	if err := cc.checkOutput(); err != nil || !cc.softSince.IsZero() {
+		t.Errorf("under the soft limit checkOutput = %v, softSince %v", err, cc.softSince)
+	}
+}
+
+func TestOutputSoftLimitWindowKeepsStart(t *testing.T) {
+	conn := &stuckConn{}
+	cc := newOutputConn(conn, outputLimit{soft: 100, window: 2 * time.Second}, 1<<20)
+	since := time.Now().Add(-time.Second)
+	cc.softSince = since
+	cc.wr.WriteBulk(make([]byte, 200))
+	cc.checkOutput()
+	// staying above the limit does not restart the window
+	if !conn.deadline.Equal(since.Add(2 * time.Second)) {
+		t.Errorf("write deadline %v, want the window started at %v", conn.deadline, since)
+	}
+	cc.softSince = time.Now().Add(-3 * time.Second)
+	cc.wr.WriteBulk(make([]byte, 200))
+	if err := cc.checkOutput(); err != errOutputSoftLimit {
+		t.Errorf("checkOutput after the window = %v", err)
+	}
+}
+
+func TestOutputFlushThreshold(t *testing.T) {
+	conn := &bufConn{}
+	s := newTestServer(1)
+	s.limits.flushThreshold = 100
+	cc := &clientConn{server: s, conn: conn, wr: NewWriter(conn)}
+	cc.wr.WriteBulk(make([]byte, 50))
+	if err := cc.checkOutput(); err != nil || conn.out.Len() != 0 {
+		t.Fatalf("under the threshold checkOutput = %v, %d bytes written", err, conn.out.Len())
+	}
+	cc.wr.WriteBulk(make([]byte, 50))
+	if err := cc.checkOutput(); err != nil || conn.out.Len() == 0 || cc.wr.Buffered() != 0 {
+		t.Errorf("over the threshold checkOutput = %v, %d bytes written, %d buffered",
+			err, conn.out.Len(), cc.wr.Buffered())
+	}
+}
+
+func TestOutputHardLimitCloses(t *testing.T) {
+	s := startServer(t, &def.ServerConf{OutputBufferLimit: def.OutputBufferLimit{Hard: 1024}})
+	conn := dialServer(t, s)
+	big := strings.Repeat("x", 2048)
+	io.WriteString(conn, "*2\r\n$4\r\necho\r\n$5\r\nsmall\r\n")
+	io.WriteString(conn, "*2\r\n$4\r\necho\r\n$2048\r\n"+big+"\r\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("reading until the server closes: %v", err)
+	}
+	if strings.Contains(string(data), big) {
+		t.Errorf("reply over the hard limit was sent")
+	}
+	if n := atomic.LoadUint64(&s.stats.outputLimitDisconnections); n != 1 {
+		t.Errorf("%d output limit disconnections", n)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	"../internal/utils"
+
+	"github.com/cihub/seelog"
+)
+
+// pipeline runs the data commands of a batch concurrently, each holding a
+// token of the server's limiter while it runs, and writes their replies in
+// the order of the commands. A command waits for the earlier ones sharing
+// one of its keys, so commands on the same key keep their order. At most
+// half of the limiter's tokens go to the jobs of one connection, so a long
+// pipeline does not starve the other clients.
+type pipeline struct {
+	cc      *clientConn
+	jobs    []*pipelineJob
+	written int
+	// the last job started on each key
+	last map[string]*pipelineJob
+}
+
+type pipelineJob struct {
+	res  *Result
+	done chan struct{}
+}
+
+func newPipeline(cc *clientConn) *pipeline {
+	return &pipeline{
+		cc:   cc,
+		last: make(map[string]*pipelineJob),
+	}
+}
+
+func (p *pipeline) pending() int {
+	return len(p.jobs) - p.written
+}
+
+// concurrentHandler returns the handler of the command when it may run next
+// to the rest of the pipeline: a command that only works on its arguments,
+// outside MULTI and subscriptions. Everything else, errors included, goes
+// through dispatch once the running commands are done.
+func (cc *clientConn) concurrentHandler(cmd Command) (*CmdHandler, string) {
+	if cc.multi || cc.pushMode() {
+		return nil, ""
+	}
+	name := utils.BytesToString(bytes.ToLower(cmd.Args[0]))
+	handler, err := cc.lookup(name, cmd.Args)
+	if err != nil || handler.connHandleFunc != nil || handler.handleFunc == nil {
+		return nil, ""
+	}
+	return handler, name
+}
+
+func (p *pipeline) start(handler *CmdHandler, name string, args [][]byte) {
+	job := &pipelineJob{done: make(chan struct{})}
+	var deps []*pipelineJob
+	for _, key := range commandKeys(name, args) {
+		if prev, ok := p.last[string(key)]; ok {
+			deps = append(deps, prev)
+		}
+		p.last[string(key)] = job
+	}
+	atomic.AddUint64(&p.cc.server.stats.commands, 1)
+	p.cc.updateInfo(name)
+	if p.cc.server.monitoring() {
+		p.cc.server.feedMonitors(p.cc, args)
+	}
+	go func() {
+		defer close(job.done)
+		// a job waiting on its keys must not hold a token
+		for _, dep := range deps {
+			<-dep.done
+		}
+		token := p.cc.server.getToken()
+		defer p.cc.server.releaseToken(token)
+		trace := p.cc.server.slowlog.newTrace()
+		startTS := time.Now()
+		job.res = handler.handle(p.cc, args, trace)
+		elapsed := time.Since(startTS)
+		p.cc.server.recordCall(name, elapsed, job.res)
+		p.cc.server.slowlog.record(p.cc, args, elapsed, trace)
+		seelog.Debugf("cost: %v ms", elapsed.Nanoseconds()/time.Millisecond.Nanoseconds())
+	}()
+	p.jobs = append(p.jobs, job)
+}
+
+// maxJobs is how many jobs of the connection may be in flight.
+func (p *pipeline) maxJobs() int {
+	if n := p.cc.server.limiter().Count() / 2; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// makeRoom waits for the oldest jobs until another one may start.
+func (p *pipeline) makeRoom() error {
+	for p.pending() >= p.maxJobs() {
+		<-p.jobs[p.written].done
+		if err := p.writeNext(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNext buffers the reply of the oldest job, which is done.
+func (p *pipeline) writeNext() error {
+	p.cc.writeResult(p.jobs[p.written].res)
+	p.jobs[p.written] = nil
+	p.written++
+	return p.cc.checkOutput()
+}
+
+// writeReplies buffers the replies of the finished jobs up to the first
+// one still running, or of all of them when wait is set.
+func (p *pipeline) writeReplies(wait bool) error {
+	for p.written < len(p.jobs) {
+		job := p.jobs[p.written]
+		if wait {
+			<-job.done
+		} else {
+			select {
+			case <-job.done:
+			default:
+				return nil
+			}
+		}
+		if err := p.writeNext(); err != nil {
+			return err
+		}
+	}
+	p.jobs, p.written = p.jobs[:0], 0
+	for key := range p.last {
+		delete(p.last, key)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bufConn collects what the connection writes.
+type bufConn struct {
+	net.Conn
+	out    bytes.Buffer
+	closed int32
+}
+
+func (c *bufConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *bufConn) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) != 0
+}
+
+func (c *bufConn) Write(b []byte) (int, error) {
+	return c.out.Write(b)
+}
+
+func (c *bufConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// newTestServer returns a server with the slow log off and no listener.
+func newTestServer(tokens int) *Server {
+	s := &Server{
+		rwlock:            &sync.RWMutex{},
+		concurrentLimiter: NewTokenLimiter(tokens),
+		cmdStats:          newCommandStats(),
+	}
+	s.slowlog.slowerThan = -1
+	return s
+}
+
+func newTestPipeline(tokens int) (*pipeline, *bytes.Buffer) {
+	s := newTestServer(tokens)
+	conn := &bufConn{}
+	cc := &clientConn{server: s, conn: conn, wr: NewWriter(conn)}
+	cc.pipeline = newPipeline(cc)
+	return cc.pipeline, &conn.out
+}
+
+func testHandler(handle func(args [][]byte) *Result) *CmdHandler {
+	return &CmdHandler{connHandleFunc: func(cc *clientConn, args [][]byte) *Result {
+		return handle(args)
+	}}
+}
+
+func intArgs(cmd, key string, i int) [][]byte {
+	return [][]byte{[]byte(cmd), []byte(key), []byte(strconv.Itoa(i))}
+}
+
+func TestPipelineReplyOrder(t *testing.T) {
+	p, out := newTestPipeline(64)
+	// the later commands finish first
+	handler := testHandler(func(args [][]byte) *Result {
+		i, _ := strconv.Atoi(string(args[2]))
+		time.Sleep(time.Duration(10-i) * time.Millisecond)
+		return &Result{status: integerStatus, integer: i}
+	})
+	var want bytes.Buffer
+	for i := 0; i < 10; i++ {
+		if err := p.makeRoom(); err != nil {
+			t.Fatal(err)
+		}
+		p.start(handler, "get", intArgs("get", fmt.Sprintf("key%d", i), i))
+		fmt.Fprintf(&want, ":%d\r\n", i)
+	}
+	if err := p.writeReplies(true); err != nil {
+		t.Fatal(err)
+	}
+	p.cc.wr.Flush()
+	if out.String() != want.String() {
+		t.Errorf("replies = %q, want %q", out.String(), want.String())
+	}
+	if p.pending() != 0 {
+		t.Errorf("pending = %d after writing every reply", p.pending())
+	}
+}
+
+func TestPipelineSameKeyOrder(t *testing.T) {
+	p, _ := newTestPipeline(64)
+	var lock sync.Mutex
+	var ran []int
+	handler := testHandler(func(args [][]byte) *Result {
+		i, _ := strconv.Atoi(string(args[2]))
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+		lock.Lock()
+		ran = append(ran, i)
+		lock.Unlock()
+		return &Result{status: integerStatus, integer: i}
+	})
+	for i := 0; i < 20; i++ {
+		if err := p.makeRoom(); err != nil {
+			t.Fatal(err)
+		}
+		p.start(handler, "set", intArgs("set", "key", i))
+	}
+	if err := p.writeReplies(true); err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range ran {
+		if n != i {
+			t.Fatalf("commands on one key ran in order %v", ran)
+		}
+	}
+}
+
+func TestPipelineWaitingJobsHoldNoToken(t *testing.T) {
+	p, _ := newTestPipeline(8)
+	release := make(chan struct{})
+	handler := testHandler(func(args [][]byte) *Result {
+		<-release
+		return &Result{status: integerStatus}
+	})
+	for i := 0; i < p.maxJobs(); i++ {
+		if err := p.makeRoom(); err != nil {
+			t.Fatal(err)
+		}
+		p.start(handler, "set", intArgs("set", "key", i))
+	}
+	// the first job runs, the others wait for it without a token
+	time.Sleep(10 * time.Millisecond)
+	if inUse := p.cc.server.limiter().InUse(); inUse != 1 {
+		t.Errorf("tokens in use = %d, want 1", inUse)
+	}
+	close(release)
+	if err := p.writeReplies(true); err != nil {
+		t.Fatal(err)
+	}
+	if inUse := p.cc.server.limiter().InUse(); inUse != 0 {
+		t.Errorf("tokens in use = %d after the pipeline", inUse)
+	}
+}
+
+func TestPipelineMaxJobs(t *testing.T) {
+	p, _ := newTestPipeline(8)
+	release := make(chan struct{})
+	handler := testHandler(func(args [][]byte) *Result {
+		<-release
+		return &Result{status: integerStatus}
+	})
+	for i := 0; i < p.maxJobs(); i++ {
+		p.start(handler, "get", intArgs("get", fmt.Sprintf("key%d", i), i))
+	}
+	done := make(chan error)
+	go func() {
+		done <- p.makeRoom()
+	}()
+	select {
+	case <-done:
+		t.Fatal("makeRoom returned with every job in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if p.pending() >= p.maxJobs() {
+		t.Errorf("pending = %d after makeRoom, max %d", p.pending(), p.maxJobs())
+	}
+}
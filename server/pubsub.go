@@ -0,0 +1,313 @@
+package server
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+
+	"../internal/utils"
+
+	"github.com/cihub/seelog"
+)
+
+const (
+	// messages waiting to be written to one subscriber, a subscriber falling
+	// further behind is disconnected
+	pushQueueSize = 1024
+)
+
+var (
+	// commands a connection may run while it has subscriptions
+	subModeCmds = map[string]bool{
+		"subscribe":    true,
+		"unsubscribe":  true,
+		"psubscribe":   true,
+		"punsubscribe": true,
+		"ping":         true,
+		"quit":         true,
+	}
+)
+
+type PubSub struct {
+	rwlock   *sync.RWMutex
+	channels map[string]map[*clientConn]bool
+	patterns map[string]map[*clientConn]bool
+}
+
+func NewPubSub() *PubSub {
+	return &PubSub{
+		rwlock:   &sync.RWMutex{},
+		channels: make(map[string]map[*clientConn]bool),
+		patterns: make(map[string]map[*clientConn]bool),
+	}
+}
+
+func (ps *PubSub) add(table map[string]map[*clientConn]bool, name string, cc *clientConn) {
+	ps.rwlock.Lock()
+	defer ps.rwlock.Unlock()
+	subs, ok := table[name]
+	if !ok {
+		subs = make(map[*clientConn]bool)
+		table[name] = subs
+	}
+	subs[cc] = true
+}
+
+func (ps *PubSub) remove(table map[string]map[*clientConn]bool, name string, cc *clientConn) {
+	ps.rwlock.Lock()
+	defer ps.rwlock.Unlock()
+	if subs, ok := table[name]; ok {
+		delete(subs, cc)
+		if len(subs) == 0 {
+			delete(table, name)
+		}
+	}
+}
+
+// Publish queues the message on every subscriber of the channel and every
+// subscriber of a matching pattern, and returns how many got it.
+func (ps *PubSub) Publish(channel, message []byte) int {
+	var cnt int
+	ps.rwlock.RLock()
+	defer ps.rwlock.RUnlock()
+	for cc := range ps.channels[utils.BytesToString(channel)] {
+		cc.push(&Result{
+			status: arrayStatus,
+			array: []*Result{
+				{status: bulkStatus, data: []byte("message")},
+				{status: bulkStatus, data: channel},
+				{status: bulkStatus, data: message},
+			},
+		})
+		cnt++
+	}
+	for pattern, subs := range ps.patterns {
+		if !utils.GlobMatch([]byte(pattern), channel) {
+			continue
+		}
+		for cc := range subs {
+			cc.push(&Result{
+				status: arrayStatus,
+				array: []*Result{
+					{status: bulkStatus, data: []byte("pmessage")},
+					{status: bulkStatus, data: []byte(pattern)},
+					{status: bulkStatus, data: channel},
+					{status: bulkStatus, data: message},
+				},
+			})
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func (ps *PubSub) Channels(pattern []byte) []string {
+	ps.rwlock.RLock()
+	defer ps.rwlock.RUnlock()
+	channels := make([]string, 0, len(ps.channels))
+	for channel := range ps.channels {
+		if pattern == nil || utils.GlobMatch(pattern, []byte(channel)) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+func (ps *PubSub) NumSub(channel []byte) int {
+	ps.rwlock.RLock()
+	defer ps.rwlock.RUnlock()
+	return len(ps.channels[utils.BytesToString(channel)])
+}
+
+func (ps *PubSub) NumPat() int {
+	ps.rwlock.RLock()
+	defer ps.rwlock.RUnlock()
+	return len(ps.patterns)
+}
+
+func (cc *clientConn) subscriptions() int {
+	return len(cc.channels) + len(cc.patterns)
+}
+
+// pushMode tells whether the connection gets replies it did not ask for,
+// as a subscriber or a monitor.
+func (cc *clientConn) pushMode() bool {
+	return cc.monitor || cc.subscriptions() > 0
+}
+
+// startPush starts the goroutine writing pushed replies, once.
+func (cc *clientConn) startPush() {
+	if cc.pushCh == nil {
+		cc.pushCh = make(chan *Result, pushQueueSize)
+		go cc.pushLoop()
+	}
+}
+
+// push hands a message to the connection's writer goroutine without ever
+// blocking the publisher.
+func (cc *clientConn) push(res *Result) {
+	select {
+	case cc.pushCh <- res:
+	default:
+		seelog.Warnf("client %d can not keep up with its pushed replies, closing", cc.id)
+		cc.conn.Close()
+	}
+}
+
+func (cc *clientConn) pushLoop() {
+	for {
+		select {
+		case res := <-cc.pushCh:
+			cc.wrlock.Lock()
+			cc.writeResult(res)
+			err := cc.checkOutput()
+			for n := len(cc.pushCh); n > 0 && err == nil; n-- {
+				cc.writeResult(<-cc.pushCh)
+				err = cc.checkOutput()
+			}
+			if err == nil {
+				err = cc.flush()
+			}
+			cc.wrlock.Unlock()
+			if err != nil {
+				cc.conn.Close()
+				return
+			}
+		case <-cc.closed:
+			return
+		}
+	}
+}
+
+func (cc *clientConn) unsubscribeAll() {
+	for channel := range cc.channels {
+		cc.server.pubsub.remove(cc.server.pubsub.channels, channel, cc)
+	}
+	for pattern := range cc.patterns {
+		cc.server.pubsub.remove(cc.server.pubsub.patterns, pattern, cc)
+	}
+	cc.channels, cc.patterns = nil, nil
+}
+
+func subscribeReply(kind string, name []byte, cnt int) *Result {
+	reply := &Result{status: nilStatus}
+	if name != nil {
+		reply = &Result{status: bulkStatus, data: name}
+	}
+	return &Result{
+		status: arrayStatus,
+		array: []*Result{
+			{status: bulkStatus, data: []byte(kind)},
+			reply,
+			{status: integerStatus, integer: cnt},
+		},
+	}
+}
+
+func (cc *clientConn) subscribe(pattern bool, names [][]byte) *Result {
+	cc.startPush()
+	table, own, kind := cc.server.pubsub.channels, &cc.channels, "subscribe"
+	if pattern {
+		table, own, kind = cc.server.pubsub.patterns, &cc.patterns, "psubscribe"
+	}
+	if *own == nil {
+		*own = make(map[string]bool)
+	}
+	result := &Result{
+		status: repliesStatus,
+		array:  make([]*Result, 0, len(names)),
+	}
+	for _, name := range names {
+		if !(*own)[string(name)] {
+			(*own)[string(name)] = true
+			cc.server.pubsub.add(table, string(name), cc)
+		}
+		result.array = append(result.array, subscribeReply(kind, name, cc.subscriptions()))
+	}
+	return result
+}
+
+func (cc *clientConn) unsubscribe(pattern bool, names [][]byte) *Result {
+	table, own, kind := cc.server.pubsub.channels, cc.channels, "unsubscribe"
+	if pattern {
+		table, own, kind = cc.server.pubsub.patterns, cc.patterns, "punsubscribe"
+	}
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, []byte(name))
+		}
+	}
+	if len(names) == 0 {
+		return subscribeReply(kind, nil, cc.subscriptions())
+	}
+	result := &Result{
+		status: repliesStatus,
+		array:  make([]*Result, 0, len(names)),
+	}
+	for _, name := range names {
+		if own[string(name)] {
+			delete(own, string(name))
+			cc.server.pubsub.remove(table, string(name), cc)
+		}
+		result.array = append(result.array, subscribeReply(kind, name, cc.subscriptions()))
+	}
+	return result
+}
+
+func subscribeHandle(cc *clientConn, args [][]byte) *Result {
+	return cc.subscribe(false, args[1:])
+}
+
+func psubscribeHandle(cc *clientConn, args [][]byte) *Result {
+	return cc.subscribe(true, args[1:])
+}
+
+func unsubscribeHandle(cc *clientConn, args [][]byte) *Result {
+	return cc.unsubscribe(false, args[1:])
+}
+
+func punsubscribeHandle(cc *clientConn, args [][]byte) *Result {
+	return cc.unsubscribe(true, args[1:])
+}
+
+func publishHandle(cc *clientConn, args [][]byte) *Result {
+	return &Result{
+		status:  integerStatus,
+		integer: cc.server.pubsub.Publish(args[1], args[2]),
+	}
+}
+
+func pubsubHandle(cc *clientConn, args [][]byte) *Result {
+	argc := len(args)
+	sub := strings.ToLower(utils.BytesToString(args[1]))
+	switch {
+	case sub == "channels" && argc <= 3:
+		var pattern []byte
+		if argc == 3 {
+			pattern = args[2]
+		}
+		return stringsResult(cc.server.pubsub.Channels(pattern))
+	case sub == "numsub":
+		result := &Result{
+			status: arrayStatus,
+			array:  make([]*Result, 0, 2*(argc-2)),
+		}
+		for _, channel := range args[2:] {
+			result.array = append(result.array,
+				&Result{status: bulkStatus, data: channel},
+				&Result{status: integerStatus, integer: cc.server.pubsub.NumSub(channel)})
+		}
+		return result
+	case sub == "numpat" && argc == 2:
+		return &Result{
+			status:  integerStatus,
+			integer: cc.server.pubsub.NumPat(),
+		}
+	}
+	return &Result{
+		status: errStatus,
+		data:   []byte("ERR Unknown subcommand or wrong number of arguments for '" + string(bytes.ToUpper(args[1])) + "'"),
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newSubscriber returns a logged in connection whose pushed replies wait
+// in its queue instead of being written.
+func newSubscriber(s *Server, queue int) (*clientConn, *addrConn) {
+	conn := &addrConn{}
+	return &clientConn{
+		server: s,
+		conn:   conn,
+		wr:     NewWriter(conn),
+		user:   defaultUser,
+		pushCh: make(chan *Result, queue),
+		closed: make(chan struct{}),
+	}, conn
+}
+
+func newPubSubServer(t *testing.T) *Server {
+	s := newTestServer(8)
+	s.pubsub = NewPubSub()
+	var err error
+	if s.acl, err = NewACL("", ""); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// dispatchOut dispatches the command and returns what it wrote.
+func dispatchOut(cc *clientConn, conn *addrConn, words ...string) string {
+	cc.dispatch(Command{Args: cmdArgs(words...)})
+	cc.wr.Flush()
+	out := conn.out.String()
+	conn.out.Reset()
+	return out
+}
+
+func subReply(kind, name string, cnt int) string {
+	if name == "" {
+		return fmt.Sprintf("*3\r\n$%d\r\n%s\r\n$-1\r\n:%d\r\n", len(kind), kind, cnt)
+	}
+	return fmt.Sprintf("*3\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n:%d\r\n", len(kind), kind, len(name), name, cnt)
+}
+
+func TestSubscribeReplies(t *testing.T) {
+	s := newPubSubServer(t)
+	cc, conn := newSubscriber(s, 16)
+	tests := []struct {
+		cmd  []string
+		want string
+	}{
+		{[]string{"subscribe", "a", "b"}, subReply("subscribe", "a", 1) + subReply("subscribe", "b", 2)},
+		{[]string{"subscribe", "a"}, subReply("subscribe", "a", 2)},
+		{[]string{"psubscribe", "news.*"}, subReply("psubscribe", "news.*", 3)},
+		{[]string{"unsubscribe", "a", "nosuch"}, subReply("unsubscribe", "a", 2) + subReply("unsubscribe", "nosuch", 2)},
+		{[]string{"unsubscribe"}, subReply("unsubscribe", "b", 1)},
+		{[]string{"unsubscribe"}, subReply("unsubscribe", "", 1)},
+		{[]string{"punsubscribe"}, subReply("punsubscribe", "news.*", 0)},
+		{[]string{"punsubscribe"}, subReply("punsubscribe", "", 0)},
+	}
+	for _, tt := range tests {
+		if got := dispatchOut(cc, conn, tt.cmd...); got != tt.want {
+			t.Errorf("%v = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+	if n := s.pubsub.NumSub([]byte("a")) + s.pubsub.NumSub([]byte("b")) + s.pubsub.NumPat(); n != 0 {
+		t.Errorf("%d subscriptions left after unsubscribing from all", n)
+	}
+}
+
+func TestPublishPatterns(t *testing.T) {
+	s := newPubSubServer(t)
+	exact, exactConn := newSubscriber(s, 16)
+	all, allConn := newSubscriber(s, 16)
+	notTech, notTechConn := newSubscriber(s, 16)
+	dispatchOut(exact, exactConn, "subscribe", "news.tech")
+	dispatchOut(all, allConn, "psubscribe", "news.*")
+	dispatchOut(notTech, notTechConn, "psubscribe", "news.[^t]*")
+
+	tests := []struct {
+		channel string
+		cnt     int
+		// the first element of the message each subscriber got, "" for none
+		exact, all, notTech string
+	}{
+		{"news.tech", 2, "message", "pmessage", ""},
+		{"news.sport", 2, "", "pmessage", "pmessage"},
+		{"weather", 0, "", "", ""},
+	}
+	for _, tt := range tests {
+		if cnt := s.pubsub.Publish([]byte(tt.channel), []byte("hello")); cnt != tt.cnt {
+			t.Errorf("PUBLISH %s reached %d subscribers, want %d", tt.channel, cnt, tt.cnt)
+		}
+		for _, sub := range []struct {
+			cc   *clientConn
+			want string
+		}{{exact, tt.exact}, {all, tt.all}, {notTech, tt.notTech}} {
+			got := ""
+			if len(sub.cc.pushCh) > 0 {
+				msg := <-sub.cc.pushCh
+				got = string(msg.array[0].data)
+				if last := msg.array[len(msg.array)-1]; string(last.data) != "hello" ||
+					string(msg.array[len(msg.array)-2].data) != tt.channel {
+					t.Errorf("PUBLISH %s delivered %+v", tt.channel, msg.array)
+				}
+			}
+			if got != sub.want {
+				t.Errorf("PUBLISH %s: subscriber got %q, want %q", tt.channel, got, sub.want)
+			}
+		}
+	}
+}
+
+func TestSubscribedModeCommands(t *testing.T) {
+	s := newPubSubServer(t)
+	cc, conn := newSubscriber(s, 16)
+	dispatchOut(cc, conn, "subscribe", "a")
+	for _, cmd := range [][]string{{"get", "key"}, {"publish", "a", "msg"}, {"multi"}} {
+		if got := dispatchOut(cc, conn, cmd...); !strings.HasPrefix(got, "-ERR only (P)SUBSCRIBE") {
+			t.Errorf("%v while subscribed = %q", cmd, got)
+		}
+	}
+	if got := dispatchOut(cc, conn, "ping"); got != "*2\r\n$4\r\npong\r\n$0\r\n\r\n" {
+		t.Errorf("PING while subscribed = %q", got)
+	}
+	dispatchOut(cc, conn, "unsubscribe")
+	if got := dispatchOut(cc, conn, "publish", "a", "msg"); got != ":0\r\n" {
+		t.Errorf("PUBLISH after unsubscribing = %q", got)
+	}
+}
+
+func TestSlowSubscriberDisconnected(t *testing.T) {
+	s := newPubSubServer(t)
+	cc, conn := newSubscriber(s, 2)
+	dispatchOut(cc, conn, "subscribe", "a")
+	for i := 0; i < 2; i++ {
+		s.pubsub.Publish([]byte("a"), []byte("msg"))
+	}
+	if conn.isClosed() {
+		t.Fatal("subscriber closed with room left in its queue")
+	}
+	s.pubsub.Publish([]byte("a"), []byte("msg"))
+	if !conn.isClosed() {
+		t.Error("subscriber with a full queue was not disconnected")
+	}
+}
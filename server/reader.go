@@ -6,18 +6,44 @@ import (
 	"strconv"
 )
 
+const (
+	// longest inline command, as in redis
+	maxInlineSize = 64 * 1024
+
+	defaultMaxBulkLen      = 512 * 1024 * 1024
+	defaultMaxMultiBulkLen = 1024 * 1024
+	defaultMaxQueryBuf     = 1024 * 1024 * 1024
+
+	defaultQueryBufSize = 4096
+	// an empty query buffer grown past this goes back to the default size
+	maxIdleQueryBufSize = 32 * 1024
+)
+
+// readerLimits bound what a client may make the reader allocate.
+type readerLimits struct {
+	maxBulkLen      int
+	maxMultiBulkLen int
+	maxQueryBuf     int
+}
+
 type Reader struct {
-	rd    *bufio.Reader
-	buf   []byte
-	start int
-	end   int
-	cmds  []Command
+	rd     *bufio.Reader
+	buf    []byte
+	start  int
+	end    int
+	cmds   []Command
+	limits readerLimits
 }
 
 func NewReader(rd io.Reader) *Reader {
 	return &Reader{
 		rd:  bufio.NewReader(rd),
-		buf: make([]byte, 4096),
+		buf: make([]byte, defaultQueryBufSize),
+		limits: readerLimits{
+			maxBulkLen:      defaultMaxBulkLen,
+			maxMultiBulkLen: defaultMaxMultiBulkLen,
+			maxQueryBuf:     defaultMaxQueryBuf,
+		},
 	}
 }
 
@@ -120,6 +146,9 @@ func (rd *Reader) readCommands(leftover *int) ([]Command, error) {
 					}
 				}
 			}
+			if len(b) > maxInlineSize {
+				return nil, errTooBigInline
+			}
 		case '*':
 			// resp formatted command
 			marks := make([]int, 0, 16)
@@ -130,7 +159,7 @@ func (rd *Reader) readCommands(leftover *int) ([]Command, error) {
 						return nil, errInvalidMultiBulkLength
 					}
 					count, err := parseInt(b[1 : i-1])
-					if err != nil || count <= 0 {
+					if err != nil || count <= 0 || count > rd.limits.maxMultiBulkLen {
 						return nil, errInvalidMultiBulkLength
 					}
 					marks = marks[:0]
@@ -149,7 +178,7 @@ func (rd *Reader) readCommands(leftover *int) ([]Command, error) {
 										return nil, errInvalidBulkLength
 									}
 									size, err := parseInt(b[si+1 : i-1])
-									if err != nil || size < 0 {
+									if err != nil || size < 0 || size > rd.limits.maxBulkLen {
 										return nil, errInvalidBulkLength
 									}
 									if i+size+2 >= len(b) {
@@ -204,6 +233,7 @@ func (rd *Reader) readCommands(leftover *int) ([]Command, error) {
 	if len(cmds) > 0 {
 		if rd.start == rd.end {
 			rd.start, rd.end = 0, 0
+			rd.shrink()
 		}
 		return cmds, nil
 	}
@@ -215,10 +245,22 @@ func (rd *Reader) readCommands(leftover *int) ([]Command, error) {
 		if rd.start == rd.end {
 			// rewind the to the beginning
 			rd.start, rd.end = 0, 0
+			rd.shrink()
+		} else if rd.start > 0 {
+			// move the partial command to the front
+			rd.end = copy(rd.buf, rd.buf[rd.start:rd.end])
+			rd.start = 0
 		} else {
-			// must grow the buffer
-			newbuf := make([]byte, len(rd.buf)*2)
-			copy(newbuf, rd.buf)
+			// must grow the buffer, up to the query buffer limit
+			if len(rd.buf) >= rd.limits.maxQueryBuf {
+				return nil, errQueryBufferLimit
+			}
+			size := len(rd.buf) * 2
+			if size > rd.limits.maxQueryBuf {
+				size = rd.limits.maxQueryBuf
+			}
+			newbuf := make([]byte, size)
+			copy(newbuf, rd.buf[:rd.end])
 			rd.buf = newbuf
 		}
 	}
@@ -230,6 +272,15 @@ func (rd *Reader) readCommands(leftover *int) ([]Command, error) {
 	return rd.readCommands(leftover)
 }
 
+// shrink drops the empty buffer when a large request grew it, so a client
+// does not hold on to that memory for the life of the connection. The
+// commands returned have their own copy of the arguments.
+func (rd *Reader) shrink() {
+	if len(rd.buf) > maxIdleQueryBufSize {
+		rd.buf = make([]byte, defaultQueryBufSize)
+	}
+}
+
 func parseInt(b []byte) (int, error) {
 	// shortcut atoi for 0-99. fails for negative numbers.
 	switch len(b) {
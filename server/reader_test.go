@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReaderShrinksQueryBuffer(t *testing.T) {
+	big := strings.Repeat("v", 200*1024)
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "*3\r\n$3\r\nset\r\n$3\r\nkey\r\n$%d\r\n%s\r\n", len(big), big)
+	rd := NewReader(&input)
+
+	cmds, err := rd.readCommands(nil)
+	if err != nil || len(cmds) != 1 || string(cmds[0].Args[2]) != big {
+		t.Fatalf("first read = %d commands, %v", len(cmds), err)
+	}
+	if len(rd.buf) != defaultQueryBufSize {
+		t.Errorf("query buffer of %d bytes after the large request", len(rd.buf))
+	}
+	if _, err := rd.readCommands(nil); err != io.EOF {
+		t.Errorf("read past the input = %v, want EOF", err)
+	}
+}
+
+func TestReaderKeepsPartialCommand(t *testing.T) {
+	big := strings.Repeat("v", 200*1024)
+	// the large command arrives with the start of the next one
+	input := fmt.Sprintf("*2\r\n$3\r\nget\r\n$%d\r\n%s\r\n*2\r\n$3\r\nget\r\n$3\r\nkey\r\n", len(big), big)
+	rd := NewReader(strings.NewReader(input))
+	var got []string
+	for {
+		cmds, err := rd.readCommands(nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cmd := range cmds {
+			got = append(got, string(cmd.Args[1]))
+		}
+	}
+	if len(got) != 2 || got[0] != big || got[1] != "key" {
+		t.Errorf("read %d commands", len(got))
+	}
+}
@@ -2,8 +2,12 @@ package server
 
 import (
 	"net"
+	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	def "../internal/defines"
 )
 
 var (
@@ -11,71 +15,201 @@ var (
 )
 
 type Server struct {
+	stats             Stats
+	cmdStats          map[string]*commandStats
 	rwlock            *sync.RWMutex
 	concurrentLimiter *TokenLimiter
 	clients           map[uint32]*clientConn
-	listener          net.Listener
+	listeners         []net.Listener
+	metricsListener   net.Listener
+	metricsServer     *http.Server
+	certs             *certStore
+	acl               *ACL
+	pubsub            *PubSub
+	monitorLock       sync.RWMutex
+	monitors          map[*clientConn]bool
+	numMonitors       int32
+	port              int
+	tlsPort           int
+	unixSocket        string
+	limits            clientLimits
+	slowlog           slowlog
+
+	closing      int32
+	connWg       sync.WaitGroup
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+
+	reloadLock sync.Mutex
+	reloader   func() error
 }
 
-func NewServer(addr string, tokenLimit int) (*Server, error) {
+func NewServer(conf *def.ServerConf, tokenLimit int) (*Server, error) {
 	s := &Server{
 		concurrentLimiter: NewTokenLimiter(tokenLimit),
 		rwlock:            &sync.RWMutex{},
 		clients:           make(map[uint32]*clientConn),
+		cmdStats:          newCommandStats(),
+		pubsub:            NewPubSub(),
+		monitors:          make(map[*clientConn]bool),
+		port:              conf.Port,
+		tlsPort:           conf.Tls.Port,
+		unixSocket:        conf.UnixSocket,
+		shutdownCh:        make(chan struct{}),
 	}
+	s.stats.startTime = time.Now()
+	s.SetClientLimits(conf)
+	s.SetSlowlog(conf)
 	var err error
-	s.listener, err = net.Listen("tcp", addr)
-	if err != nil {
+	if s.acl, err = NewACL(conf.RequirePass, conf.AclFile); err != nil {
 		return nil, err
 	}
+	if err = s.listen(conf); err != nil {
+		s.Close()
+		return nil, err
+	}
+	go s.sampleOps()
 	return s, nil
 }
 
+func (s *Server) limiter() *TokenLimiter {
+	s.rwlock.RLock()
+	defer s.rwlock.RUnlock()
+	return s.concurrentLimiter
+}
+
 func (s *Server) getToken() *Token {
-	return s.concurrentLimiter.Get()
+	start := time.Now()
+	token := s.limiter().Get()
+	usec := uint64(time.Since(start) / time.Microsecond)
+	atomic.AddUint64(&s.stats.tokenWaitUsec, usec)
+	s.stats.tokenWait.record(usec)
+	return token
 }
 
 func (s *Server) releaseToken(token *Token) {
-	s.concurrentLimiter.Put(token)
+	token.owner.Put(token)
 }
 
+// SetConcurrency replaces the limiter. Commands holding a token of the old
+// one return it there, so until they finish the new limit may be exceeded.
+func (s *Server) SetConcurrency(tokenLimit int) {
+	if tokenLimit <= 0 || tokenLimit == s.limiter().Count() {
+		return
+	}
+	s.rwlock.Lock()
+	s.concurrentLimiter = NewTokenLimiter(tokenLimit)
+	s.rwlock.Unlock()
+}
+
+// Run accepts on every listener until Close. It returns the first accept
+// error, or nil once all listeners are closed.
 func (s *Server) Run() error {
+	s.rwlock.RLock()
+	listeners, metricsListener, metricsServer := s.listeners, s.metricsListener, s.metricsServer
+	s.rwlock.RUnlock()
+	if metricsListener != nil {
+		go s.serveMetrics(metricsServer, metricsListener)
+	}
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- s.serve(listener)
+		}(listener)
+	}
+	for range listeners {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) serve(listener net.Listener) error {
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
-			if opErr, ok := err.(*net.OpError); ok {
-				return opErr.Err
+			if s.isClosing() {
+				return nil
 			}
+			if opErr, ok := err.(*net.OpError); ok && opErr.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		// Add must not race the Wait of Shutdown, which sets closing under
+		// the write lock before waiting
+		s.rwlock.RLock()
+		if s.isClosing() {
+			s.rwlock.RUnlock()
+			conn.Close()
+			return nil
 		}
+		s.connWg.Add(1)
+		s.rwlock.RUnlock()
 		go s.onConn(conn)
 	}
 }
 
 func (s *Server) onConn(c net.Conn) {
+	defer s.connWg.Done()
+	atomic.AddUint64(&s.stats.connections, 1)
+	limits := s.clientLimits()
+	tuneConn(c, limits)
 	conn := s.newConn(c)
 	s.rwlock.Lock()
-	s.clients[conn.id] = conn
+	full := limits.maxClients > 0 && len(s.clients) >= limits.maxClients
+	if !full {
+		s.clients[conn.id] = conn
+	}
 	s.rwlock.Unlock()
+	if full {
+		atomic.AddUint64(&s.stats.rejectedConnections, 1)
+		c.SetWriteDeadline(time.Now().Add(time.Second))
+		c.Write([]byte(errMaxClients))
+		c.Close()
+		return
+	}
+	if s.isClosing() {
+		// accepted just before the listener closed, Shutdown may not see it
+		conn.Close()
+		return
+	}
 	conn.Run()
 }
 
 func (s *Server) newConn(conn net.Conn) *clientConn {
+	stat := &countingConn{Conn: conn}
 	cc := &clientConn{
 		id:     atomic.AddUint32(&baseConnID, 1),
-		conn:   conn,
+		conn:   stat,
+		stat:   stat,
 		server: s,
-		wr:     NewWriter(conn),
-		rd:     NewReader(conn),
+		wr:     NewWriter(stat),
+		rd:     NewReader(stat),
+		user:   s.acl.DefaultLogin(),
+		closed: make(chan struct{}),
 	}
+	cc.pipeline = newPipeline(cc)
+	now := time.Now()
+	cc.info.created, cc.info.lastActive = now, now
+	cc.updateInfo("")
 	return cc
 }
 
 func (s *Server) Close() {
 	s.rwlock.Lock()
 	defer s.rwlock.Unlock()
-	if s.listener != nil {
-		s.listener.Close()
-		s.listener = nil
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	s.listeners = nil
+	if s.metricsListener != nil {
+		// closes the listener and the scrapes in progress
+		s.metricsServer.Close()
+		s.metricsListener.Close()
+		s.metricsListener, s.metricsServer = nil, nil
 	}
 }
 
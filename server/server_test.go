@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	def "../internal/defines"
+)
+
+// startServer runs a server on a unix socket in a temporary directory,
+// closed when the test ends.
+func startServer(t *testing.T, conf *def.ServerConf) *Server {
+	conf.UnixSocket = filepath.Join(t.TempDir(), "goha.sock")
+	s, err := NewServer(conf, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func dialServer(t *testing.T, s *Server) net.Conn {
+	conn, err := net.Dial("unix", s.unixSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
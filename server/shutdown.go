@@ -0,0 +1,71 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"../hustdb/binlog"
+
+	"github.com/cihub/seelog"
+)
+
+// RequestShutdown asks the owner of the server, see ShutdownRequested, to
+// run Shutdown. It is what the SHUTDOWN command does.
+func (s *Server) RequestShutdown() {
+	s.shutdownOnce.Do(func() {
+		close(s.shutdownCh)
+	})
+}
+
+func (s *Server) ShutdownRequested() <-chan struct{} {
+	return s.shutdownCh
+}
+
+func (s *Server) isClosing() bool {
+	return atomic.LoadInt32(&s.closing) != 0
+}
+
+// Shutdown stops accepting connections, lets every client finish the
+// pipeline it is running, then waits for the binlog tasks to drain. Clients
+// still busy when the timeout expires are disconnected.
+func (s *Server) Shutdown(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	s.rwlock.Lock()
+	atomic.StoreInt32(&s.closing, 1)
+	s.rwlock.Unlock()
+	s.Close()
+
+	// a pending read fails at once, a client in the middle of a pipeline
+	// fails on its next read after flushing the replies
+	for _, cc := range s.Clients() {
+		cc.conn.SetReadDeadline(time.Now())
+	}
+	done := make(chan struct{})
+	go func() {
+		s.connWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		seelog.Info("all clients finished")
+	case <-time.After(deadline.Sub(time.Now())):
+		seelog.Warnf("%d clients still busy after %v, closing them", s.ConnectionCount(), timeout)
+		for _, cc := range s.Clients() {
+			cc.conn.Close()
+		}
+	}
+
+	if !binlog.Drain(deadline.Sub(time.Now())) {
+		seelog.Warn("binlog tasks still pending at shutdown deadline")
+	}
+}
+
+func shutdownHandle(cc *clientConn, args [][]byte) *Result {
+	seelog.Infof("SHUTDOWN requested by client %d %v", cc.id, cc.conn.RemoteAddr())
+	cc.quit = true
+	cc.server.RequestShutdown()
+	return &Result{
+		status: successStatus,
+		data:   []byte("OK"),
+	}
+}
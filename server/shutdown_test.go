@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"../hustdb/binlog"
+	def "../internal/defines"
+)
+
+var binlogOnce sync.Once
+
+func initBinlog() {
+	binlogOnce.Do(func() {
+		binlog.Init(def.BinlogConf{RoutineCnt: 1, TaskChanCap: 16})
+	})
+}
+
+// slowHustdb answers every request after delay.
+type slowHustdb struct {
+	delay time.Duration
+}
+
+func (h slowHustdb) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(h.delay)
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestShutdownWaitsForCommand(t *testing.T) {
+	initBinlog()
+	startHustdb(t, slowHustdb{delay: 300 * time.Millisecond})
+	s := startServer(t, &def.ServerConf{})
+	conn := dialServer(t, s)
+	rd := bufio.NewReader(conn)
+	// the connection is registered once it answered
+	io.WriteString(conn, "*1\r\n$4\r\nping\r\n")
+	if line, err := rd.ReadString('\n'); err != nil || line != "+PONG\r\n" {
+		t.Fatalf("PING = %q, %v", line, err)
+	}
+	io.WriteString(conn, "*2\r\n$3\r\nget\r\n$3\r\nkey\r\n")
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	s.Shutdown(5 * time.Second)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("Shutdown returned after %v, want it to wait for the GET", elapsed)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if line, err := rd.ReadString('\n'); err != nil || line != "$-1\r\n" {
+		t.Errorf("GET in flight at shutdown = %q, %v", line, err)
+	}
+	if _, err := rd.ReadByte(); err != io.EOF {
+		t.Errorf("connection still open after Shutdown: %v", err)
+	}
+}
+
+func TestShutdownWaitsForBinlog(t *testing.T) {
+	initBinlog()
+	loadRegions(t, "127.0.0.1:8085")
+	tests := []struct {
+		task    time.Duration
+		timeout time.Duration
+		// how long Shutdown should take
+		want time.Duration
+	}{
+		{300 * time.Millisecond, 5 * time.Second, 300 * time.Millisecond},
+		{2 * time.Second, 300 * time.Millisecond, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		s := startServer(t, &def.ServerConf{})
+		ran := make(chan struct{})
+		binlog.DeliverBinlogTask(0, func() interface{} {
+			time.Sleep(tt.task)
+			close(ran)
+			return true
+		}, nil)
+		start := time.Now()
+		s.Shutdown(tt.timeout)
+		elapsed := time.Since(start)
+		if elapsed < tt.want-50*time.Millisecond || elapsed > tt.want+time.Second {
+			t.Errorf("task of %v, timeout %v: Shutdown took %v, want %v", tt.task, tt.timeout, elapsed, tt.want)
+		}
+		select {
+		case <-ran:
+			if tt.task > tt.timeout {
+				t.Errorf("task of %v finished before the %v timeout", tt.task, tt.timeout)
+			}
+		default:
+			if tt.task < tt.timeout {
+				t.Errorf("Shutdown returned before the task of %v ran", tt.task)
+			}
+		}
+		<-ran
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"../hustdb/comm"
+	def "../internal/defines"
+	"../internal/utils"
+)
+
+const (
+	defaultSlowlogSlowerThan = 10000
+	defaultSlowlogMaxLen     = 128
+
+	// an entry keeps at most this many arguments, each cut to this many bytes
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     [][]byte
+	addr     string
+	name     string
+	calls    []comm.BackendCall
+}
+
+// slowlog keeps the latest commands that ran longer than slowerThan, newest
+// first, with the hustdb requests each of them made.
+type slowlog struct {
+	// microseconds, negative when disabled
+	slowerThan int64
+
+	lock    sync.Mutex
+	maxLen  int
+	nextId  int64
+	entries []*slowlogEntry
+}
+
+// SetSlowlog applies the slow log settings, shrinking the log when the new
+// length is shorter.
+func (s *Server) SetSlowlog(conf *def.ServerConf) {
+	slowerThan := defaultSlowlogSlowerThan
+	if conf.SlowlogLogSlowerThan != nil {
+		slowerThan = *conf.SlowlogLogSlowerThan
+	}
+	atomic.StoreInt64(&s.slowlog.slowerThan, int64(slowerThan))
+	s.slowlog.lock.Lock()
+	defer s.slowlog.lock.Unlock()
+	s.slowlog.maxLen = orDefault(conf.SlowlogMaxLen, defaultSlowlogMaxLen)
+	if len(s.slowlog.entries) > s.slowlog.maxLen {
+		s.slowlog.entries = s.slowlog.entries[:s.slowlog.maxLen]
+	}
+}
+
+// newTrace returns the trace for the next command, nil while the slow log is
+// disabled so the backend requests are not recorded for nothing.
+func (l *slowlog) newTrace() *comm.Trace {
+	if atomic.LoadInt64(&l.slowerThan) < 0 {
+		return nil
+	}
+	return comm.NewTrace()
+}
+
+func (l *slowlog) record(cc *clientConn, args [][]byte, duration time.Duration, trace *comm.Trace) {
+	slowerThan := atomic.LoadInt64(&l.slowerThan)
+	if slowerThan < 0 || duration < time.Duration(slowerThan)*time.Microsecond {
+		return
+	}
+	entry := &slowlogEntry{
+		time:     time.Now().Add(-duration),
+		duration: duration,
+		args:     slowlogArgs(args),
+		addr:     cc.conn.RemoteAddr().String(),
+		name:     cc.getName(),
+	}
+	if trace != nil {
+		entry.calls = trace.Calls()
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	entry.id = l.nextId
+	l.nextId++
+	l.entries = append(l.entries, nil)
+	copy(l.entries[1:], l.entries)
+	l.entries[0] = entry
+	if len(l.entries) > l.maxLen {
+		l.entries = l.entries[:l.maxLen]
+	}
+}
+
+// slowlogArgs copies the arguments, cut the way redis does and with the
+// passwords redacted like MONITOR does.
+func slowlogArgs(args [][]byte) [][]byte {
+	argc := len(args)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	redactFrom := redactFrom(args)
+	out := make([][]byte, 0, argc)
+	for i := 0; i < argc; i++ {
+		if i == argc-1 && argc != len(args) {
+			out = append(out, []byte(fmt.Sprintf("... (%d more arguments)", len(args)-argc+1)))
+			break
+		}
+		arg := args[i]
+		if i >= redactFrom {
+			arg = []byte(redactedArg)
+		} else if len(arg) > slowlogMaxArgLen {
+			arg = append(arg[:slowlogMaxArgLen:slowlogMaxArgLen],
+				fmt.Sprintf("... (%d more bytes)", len(args[i])-slowlogMaxArgLen)...)
+		} else {
+			arg = append([]byte(nil), arg...)
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+func (l *slowlog) get(count int) []*slowlogEntry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if count < 0 || count > len(l.entries) {
+		count = len(l.entries)
+	}
+	return append([]*slowlogEntry(nil), l.entries[:count]...)
+}
+
+func (l *slowlog) len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.entries)
+}
+
+func (l *slowlog) reset() {
+	l.lock.Lock()
+	l.entries = nil
+	l.lock.Unlock()
+}
+
+// reply renders the entry as SLOWLOG GET does, followed by the backend
+// requests as [backend, op, status, microseconds] arrays.
+func (entry *slowlogEntry) reply() *Result {
+	args := make([]*Result, 0, len(entry.args))
+	for _, arg := range entry.args {
+		args = append(args, &Result{status: bulkStatus, data: arg})
+	}
+	calls := make([]*Result, 0, len(entry.calls))
+	for _, call := range entry.calls {
+		calls = append(calls, &Result{
+			status: arrayStatus,
+			array: []*Result{
+				{status: bulkStatus, data: []byte(call.Backend)},
+				{status: bulkStatus, data: []byte(call.Op)},
+				{status: integerStatus, integer: call.Code},
+				{status: integerStatus, integer: int(call.Elapsed / time.Microsecond)},
+			},
+		})
+	}
+	return &Result{
+		status: arrayStatus,
+		array: []*Result{
+			{status: integerStatus, integer: int(entry.id)},
+			{status: integerStatus, integer: int(entry.time.Unix())},
+			{status: integerStatus, integer: int(entry.duration / time.Microsecond)},
+			{status: arrayStatus, array: args},
+			{status: bulkStatus, data: []byte(entry.addr)},
+			{status: bulkStatus, data: []byte(entry.name)},
+			{status: arrayStatus, array: calls},
+		},
+	}
+}
+
+func slowlogHandle(cc *clientConn, args [][]byte) *Result {
+	argc := len(args)
+	sub := strings.ToLower(utils.BytesToString(args[1]))
+	switch {
+	case sub == "get" && argc <= 3:
+		count := 10
+		if argc == 3 {
+			var err error
+			if count, err = strconv.Atoi(utils.BytesToString(args[2])); err != nil || count < -1 {
+				return &Result{
+					status: errStatus,
+					data:   []byte("ERR count should be greater than or equal to -1"),
+				}
+			}
+		}
+		entries := cc.server.slowlog.get(count)
+		result := &Result{
+			status: arrayStatus,
+			array:  make([]*Result, 0, len(entries)),
+		}
+		for _, entry := range entries {
+			result.array = append(result.array, entry.reply())
+		}
+		return result
+	case sub == "len" && argc == 2:
+		return &Result{status: integerStatus, integer: cc.server.slowlog.len()}
+	case sub == "reset" && argc == 2:
+		cc.server.slowlog.reset()
+		return &Result{status: successStatus, data: []byte("OK")}
+	}
+	return &Result{
+		status: errStatus,
+		data:   []byte("ERR Unknown subcommand or wrong number of arguments for '" + string(bytes.ToUpper(args[1])) + "'"),
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowlogRedactsPasswords(t *testing.T) {
+	s := newTestServer(1)
+	s.slowlog.slowerThan = 0
+	s.slowlog.maxLen = 10
+	cc := &clientConn{server: s, conn: &addrConn{}}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"AUTH", "secret"}, []string{"AUTH", redactedArg}},
+		{[]string{"auth", "app", "secret"}, []string{"auth", redactedArg, redactedArg}},
+		{[]string{"acl", "SETUSER", "app", "on", ">secret", "~*"}, []string{"acl", "SETUSER", "app", redactedArg, redactedArg, redactedArg}},
+		{[]string{"acl", "getuser", "app"}, []string{"acl", "getuser", "app"}},
+		{[]string{"set", "key", "secret"}, []string{"set", "key", "secret"}},
+	}
+	for _, tt := range tests {
+		s.slowlog.record(cc, cmdArgs(tt.args...), time.Millisecond, nil)
+		res := slowlogHandle(cc, cmdArgs("slowlog", "get", "1"))
+		var got []string
+		for _, arg := range res.array[0].array[3].array {
+			got = append(got, string(arg.data))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("SLOWLOG GET of %v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
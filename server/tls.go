@@ -0,0 +1,104 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	def "../internal/defines"
+
+	"github.com/cihub/seelog"
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"":    tls.VersionTLS12,
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// certStore holds the material of the TLS listener. Every handshake asks it
+// for the current config, so a reload takes effect on the next connection.
+type certStore struct {
+	lock   sync.RWMutex
+	config *tls.Config
+}
+
+func newCertStore(conf *def.TlsConf) (*certStore, error) {
+	config, err := loadTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	cs := &certStore{}
+	cs.set(config, conf.CertFile)
+	return cs, nil
+}
+
+// loadTLSConfig builds a config from the files named in conf.
+func loadTLSConfig(conf *def.TlsConf) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[conf.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unknown TLS version %q", conf.MinVersion)
+	}
+	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}
+	if conf.ClientCA != "" {
+		pem, err := ioutil.ReadFile(conf.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + conf.ClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func (cs *certStore) set(config *tls.Config, certFile string) {
+	cs.lock.Lock()
+	cs.config = config
+	cs.lock.Unlock()
+	seelog.Infof("TLS certificate loaded from %s", certFile)
+}
+
+func (cs *certStore) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	return cs.config, nil
+}
+
+func (cs *certStore) listenerConfig() *tls.Config {
+	return &tls.Config{GetConfigForClient: cs.configForClient}
+}
+
+// ReloadCerts re-reads the TLS files and returns the function putting them
+// in place, so a reload can check everything before applying anything. The
+// current certificates stay if any file is broken. Without a TLS listener
+// there is nothing to load.
+func (s *Server) ReloadCerts(conf *def.TlsConf) (func(), error) {
+	if s.certs == nil {
+		return func() {}, nil
+	}
+	config, err := loadTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		s.certs.set(config, conf.CertFile)
+	}, nil
+}
@@ -1,6 +1,9 @@
 package server
 
+// Token remembers its limiter so it goes back to the right one after the
+// limiter has been replaced.
 type Token struct {
+	owner *TokenLimiter
 }
 
 type TokenLimiter struct {
@@ -22,7 +25,15 @@ func NewTokenLimiter(count int) *TokenLimiter {
 		ch:    make(chan *Token, count),
 	}
 	for i := 0; i < count; i++ {
-		tl.ch <- &Token{}
+		tl.ch <- &Token{owner: tl}
 	}
 	return tl
 }
+
+func (tl *TokenLimiter) Count() int {
+	return tl.count
+}
+
+func (tl *TokenLimiter) InUse() int {
+	return tl.count - len(tl.ch)
+}
@@ -24,6 +24,16 @@ func (wr *Writer) Flush() error {
 	return nil
 }
 
+// Buffered returns how many bytes wait for the next Flush.
+func (wr *Writer) Buffered() int {
+	return len(wr.b)
+}
+
+// Reset drops the buffered bytes.
+func (wr *Writer) Reset() {
+	wr.b = nil
+}
+
 func (wr *Writer) WriteError(msg string) {
 	wr.b = append(wr.b, '-')
 	wr.b = append(wr.b, msg...)
@@ -73,3 +83,7 @@ func (wr *Writer) WriteArray(count int) {
 func (wr *Writer) WriteNULL() {
 	wr.b = append(wr.b, '$', '-', '1', '\r', '\n')
 }
+
+func (wr *Writer) WriteNullArray() {
+	wr.b = append(wr.b, '*', '-', '1', '\r', '\n')
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestWriteResult(t *testing.T) {
+	tests := []struct {
+		res  *Result
+		want string
+	}{
+		{nil, "$-1\r\n"},
+		{&Result{status: successStatus, data: []byte("OK")}, "+OK\r\n"},
+		{&Result{status: errStatus, data: []byte("ERR bad")}, "-ERR bad\r\n"},
+		{&Result{status: integerStatus, integer: -3}, ":-3\r\n"},
+		{&Result{status: bulkStatus, data: []byte("a\r\nb\x00c")}, "$6\r\na\r\nb\x00c\r\n"},
+		{&Result{status: bulkStatus, data: []byte{}}, "$0\r\n\r\n"},
+		{&Result{status: nilStatus}, "$-1\r\n"},
+		{&Result{status: nilArrayStatus}, "*-1\r\n"},
+		{&Result{status: arrayStatus, array: []*Result{
+			{status: bulkStatus, data: []byte("+OK\r\n")},
+			nil,
+			{status: arrayStatus, array: []*Result{{status: integerStatus, integer: 1}}},
+		}}, "*3\r\n$5\r\n+OK\r\n\r\n$-1\r\n*1\r\n:1\r\n"},
+		{&Result{status: repliesStatus, array: []*Result{
+			{status: successStatus, data: []byte("OK")},
+			{status: integerStatus, integer: 2},
+		}}, "+OK\r\n:2\r\n"},
+	}
+	for _, tt := range tests {
+		conn := &bufConn{}
+		cc := &clientConn{conn: conn, wr: NewWriter(conn)}
+		cc.writeResult(tt.res)
+		cc.wr.Flush()
+		if got := conn.out.String(); got != tt.want {
+			t.Errorf("writeResult(%+v) = %q, want %q", tt.res, got, tt.want)
+		}
+	}
+}
+
+func TestGetBinaryValue(t *testing.T) {
+	startHustdb(t, &fakeHustdb{versions: map[string]int{}})
+	val := "line1\r\n+OK\r\n\x00\xff"
+	cc := newTestConn()
+	if res := CmdMap["set"].handle(cc, cmdArgs("set", "bin", val), nil); res.status != successStatus {
+		t.Fatalf("SET = %+v", res)
+	}
+	res := CmdMap["get"].handle(cc, cmdArgs("get", "bin"), nil)
+	if res.status != bulkStatus || string(res.data) != val {
+		t.Fatalf("GET = %+v, want the bulk %q", res, val)
+	}
+	conn := &bufConn{}
+	cc.conn, cc.wr = conn, NewWriter(conn)
+	cc.writeResult(res)
+	cc.wr.Flush()
+	if want := "$" + strconv.Itoa(len(val)) + "\r\n" + val + "\r\n"; conn.out.String() != want {
+		t.Errorf("GET reply = %q, want %q", conn.out.String(), want)
+	}
+}